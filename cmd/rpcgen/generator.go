@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// serviceDirective -> the doc comment directive declaring the service name
+const serviceDirective = "//rpc:service "
+
+type methodKind int
+
+const (
+	unary methodKind = iota
+	serverStream
+	clientStream
+	bidiStream
+)
+
+type method struct {
+	Name string
+	Kind methodKind
+	// the element type of the request, empty if the client sends a stream
+	In string
+	// the element type of the response, empty if the server sends a stream
+	Out string
+}
+
+func (m method) IsUnary() bool        { return m.Kind == unary }
+func (m method) IsServerStream() bool { return m.Kind == serverStream }
+func (m method) IsClientStream() bool { return m.Kind == clientStream }
+
+type service struct {
+	// the interface name
+	Name        string
+	ServiceName string
+	Methods     []method
+}
+
+func (s service) Unary() []method {
+	return s.filter(func(m method) bool { return m.Kind == unary })
+}
+
+func (s service) Streams() []method {
+	return s.filter(func(m method) bool { return m.Kind != unary })
+}
+
+func (s service) filter(fn func(m method) bool) []method {
+	res := make([]method, 0, len(s.Methods))
+	for _, m := range s.Methods {
+		if fn(m) {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+type file struct {
+	Source   string
+	Package  string
+	Imports  []string
+	Services []service
+}
+
+// generate -> parse the interfaces in source and generate the stubs
+func generate(source string, types []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, source, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{
+		fset:    fset,
+		imports: importsOf(f),
+		used:    map[string]string{"context": strconv.Quote("context"), "rpc": strconv.Quote("emicro/rpc")},
+	}
+	res := file{
+		Source:  filepath.Base(source),
+		Package: f.Name.Name,
+	}
+	for _, name := range types {
+		name = strings.TrimSpace(name)
+		spec, doc := findInterface(f, name)
+		if spec == nil {
+			return nil, fmt.Errorf("interface %s is not found in %s", name, source)
+		}
+		srv, err := g.parseService(name, spec, doc)
+		if err != nil {
+			return nil, err
+		}
+		res.Services = append(res.Services, srv)
+	}
+	for _, path := range g.used {
+		res.Imports = append(res.Imports, path)
+	}
+	sort.Strings(res.Imports)
+
+	buf := &bytes.Buffer{}
+	if err = fileTpl.Execute(buf, res); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+type generator struct {
+	fset *token.FileSet
+	// package name -> import spec of the source file
+	imports map[string]string
+	// the imports needed by the generated code
+	used map[string]string
+}
+
+// importsOf -> the package name is the alias or the last element of the path
+func importsOf(f *ast.File) map[string]string {
+	res := make(map[string]string, len(f.Imports))
+	for _, imp := range f.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		name := filepath.Base(path)
+		spec := imp.Path.Value
+		if imp.Name != nil {
+			name = imp.Name.Name
+			spec = name + " " + spec
+		}
+		res[name] = spec
+	}
+	return res
+}
+
+func findInterface(f *ast.File, name string) (*ast.InterfaceType, *ast.CommentGroup) {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if ts.Name.Name != name {
+				continue
+			}
+			it, ok := ts.Type.(*ast.InterfaceType)
+			if !ok {
+				return nil, nil
+			}
+			doc := ts.Doc
+			if doc == nil {
+				doc = gen.Doc
+			}
+			return it, doc
+		}
+	}
+	return nil, nil
+}
+
+func (g *generator) parseService(name string, it *ast.InterfaceType, doc *ast.CommentGroup) (service, error) {
+	srv := service{Name: name, ServiceName: name}
+	if doc != nil {
+		for _, c := range doc.List {
+			if strings.HasPrefix(c.Text, serviceDirective) {
+				srv.ServiceName = strings.TrimSpace(strings.TrimPrefix(c.Text, serviceDirective))
+			}
+		}
+	}
+	for _, field := range it.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok {
+			return srv, fmt.Errorf("%s: embedded interfaces are not supported", name)
+		}
+		for _, ident := range field.Names {
+			// Name() of rpc.Service is not a rpc method
+			if ident.Name == "Name" {
+				continue
+			}
+			m, err := g.parseMethod(ident.Name, ft)
+			if err != nil {
+				return srv, fmt.Errorf("%s.%s: %w", name, ident.Name, err)
+			}
+			srv.Methods = append(srv.Methods, m)
+		}
+	}
+	return srv, nil
+}
+
+// parseMethod -> the method must be in one of the four shapes supported by rpc.Server
+func (g *generator) parseMethod(name string, ft *ast.FuncType) (method, error) {
+	params := flatten(ft.Params)
+	results := flatten(ft.Results)
+	m := method{Name: name}
+	if len(params) == 0 || g.expr(params[0]) != "context.Context" {
+		return m, fmt.Errorf("the first parameter must be context.Context")
+	}
+	if len(results) == 0 || g.expr(results[len(results)-1]) != "error" {
+		return m, fmt.Errorf("the last result must be error")
+	}
+	var err error
+	isStream := isServerStream(params[len(params)-1])
+	switch {
+	case !isStream && len(params) == 2 && len(results) == 2:
+		m.Kind = unary
+		if m.In, err = g.elem(params[1]); err == nil {
+			m.Out, err = g.elem(results[0])
+		}
+	case isStream && len(params) == 3 && len(results) == 1:
+		m.Kind = serverStream
+		m.In, err = g.elem(params[1])
+	case isStream && len(params) == 2 && len(results) == 2:
+		m.Kind = clientStream
+		m.Out, err = g.elem(results[0])
+	case isStream && len(params) == 2 && len(results) == 1:
+		m.Kind = bidiStream
+	default:
+		err = fmt.Errorf("unsupported method signature")
+	}
+	return m, err
+}
+
+// flatten -> one expression per parameter, (a, b *Req) has two
+func flatten(list *ast.FieldList) []ast.Expr {
+	if list == nil {
+		return nil
+	}
+	res := make([]ast.Expr, 0, len(list.List))
+	for _, field := range list.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			res = append(res, field.Type)
+		}
+	}
+	return res
+}
+
+func isServerStream(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name == "ServerStream"
+	case *ast.SelectorExpr:
+		return e.Sel.Name == "ServerStream"
+	}
+	return false
+}
+
+// elem -> requests and responses must be pointers, returns the element type
+func (g *generator) elem(expr ast.Expr) (string, error) {
+	star, ok := expr.(*ast.StarExpr)
+	if !ok {
+		return "", fmt.Errorf("request and response must be pointers, got %s", g.expr(expr))
+	}
+	g.use(star.X)
+	return g.expr(star.X), nil
+}
+
+// use -> record the imports referenced by expr
+func (g *generator) use(expr ast.Expr) {
+	ast.Inspect(expr, func(node ast.Node) bool {
+		sel, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if pkg, ok := sel.X.(*ast.Ident); ok {
+			if spec, ok := g.imports[pkg.Name]; ok {
+				g.used[pkg.Name] = spec
+			}
+		}
+		return false
+	})
+}
+
+func (g *generator) expr(expr ast.Expr) string {
+	buf := &bytes.Buffer{}
+	_ = printer.Fprint(buf, g.fset, expr)
+	return buf.String()
+}
+
+var fileTpl = template.Must(template.New("file").Parse(`// Code generated by rpcgen. DO NOT EDIT.
+// source: {{ .Source }}
+
+package {{ .Package }}
+
+import (
+{{- range .Imports }}
+	{{ . }}
+{{- end }}
+)
+{{ range .Services }}{{ $srv := . }}
+// {{ .Name }}Client -> typed client of {{ .ServiceName }}
+type {{ .Name }}Client struct {
+	cc rpc.Caller
+}
+
+func New{{ .Name }}Client(cc rpc.Caller) *{{ .Name }}Client {
+	return &{{ .Name }}Client{cc: cc}
+}
+{{ range .Methods }}
+{{- if .IsUnary }}
+func (c *{{ $srv.Name }}Client) {{ .Name }}(ctx context.Context, req *{{ .In }}) (*{{ .Out }}, error) {
+	resp := new({{ .Out }})
+	err := c.cc.Call(ctx, "{{ $srv.ServiceName }}", "{{ .Name }}", req, resp)
+	return resp, err
+}
+{{ else if .IsServerStream }}
+func (c *{{ $srv.Name }}Client) {{ .Name }}(ctx context.Context, req *{{ .In }}) (rpc.ClientStream, error) {
+	stream, err := c.cc.Stream(ctx, "{{ $srv.ServiceName }}", "{{ .Name }}")
+	if err != nil {
+		return nil, err
+	}
+	if err = rpc.SendOnly(stream, req); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+{{ else }}
+func (c *{{ $srv.Name }}Client) {{ .Name }}(ctx context.Context) (rpc.ClientStream, error) {
+	return c.cc.Stream(ctx, "{{ $srv.ServiceName }}", "{{ .Name }}")
+}
+{{ end }}
+{{- end }}
+// Register{{ .Name }}Server -> register impl with the generated dispatch table
+func Register{{ .Name }}Server(s *rpc.Server, impl {{ .Name }}) error {
+	return s.RegisterServiceDesc(&{{ .Name }}Desc, impl)
+}
+
+var {{ .Name }}Desc = rpc.ServiceDesc{
+	ServiceName: "{{ .ServiceName }}",
+	Methods: map[string]rpc.MethodHandler{
+{{- range .Unary }}
+		"{{ .Name }}": _{{ $srv.Name }}_{{ .Name }}_Handler,
+{{- end }}
+	},
+	Streams: map[string]rpc.StreamHandler{
+{{- range .Streams }}
+		"{{ .Name }}": _{{ $srv.Name }}_{{ .Name }}_Handler,
+{{- end }}
+	},
+}
+{{ range .Methods }}
+{{- if .IsUnary }}
+func _{{ $srv.Name }}_{{ .Name }}_Handler(srv any, ctx context.Context, dec func(in any) error) (any, error) {
+	in := new({{ .In }})
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.({{ $srv.Name }}).{{ .Name }}(ctx, in)
+	if out == nil {
+		return nil, err
+	}
+	return out, err
+}
+{{ else if .IsServerStream }}
+func _{{ $srv.Name }}_{{ .Name }}_Handler(srv any, stream rpc.ServerStream) error {
+	in := new({{ .In }})
+	if err := stream.Recv(in); err != nil {
+		return err
+	}
+	return srv.({{ $srv.Name }}).{{ .Name }}(stream.Context(), in, stream)
+}
+{{ else if .IsClientStream }}
+func _{{ $srv.Name }}_{{ .Name }}_Handler(srv any, stream rpc.ServerStream) error {
+	out, err := srv.({{ $srv.Name }}).{{ .Name }}(stream.Context(), stream)
+	if out != nil {
+		if er := stream.Send(out); er != nil {
+			return er
+		}
+	}
+	return err
+}
+{{ else }}
+func _{{ $srv.Name }}_{{ .Name }}_Handler(srv any, stream rpc.ServerStream) error {
+	return srv.({{ $srv.Name }}).{{ .Name }}(stream.Context(), stream)
+}
+{{ end }}
+{{- end }}
+{{- end }}`))
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	// the generated code is committed, it must be up to date
+	want, err := os.ReadFile("internal/example/user.rpc.go")
+	require.NoError(t, err)
+	got, err := generate("internal/example/user.go", []string{"UserService"})
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestGenerate_Error(t *testing.T) {
+	testCases := []struct {
+		name    string
+		src     string
+		types   []string
+		wantErr string
+	}{
+		{
+			name:    "not found",
+			src:     "package a\n",
+			types:   []string{"UserService"},
+			wantErr: "interface UserService is not found in",
+		},
+		{
+			name: "no context",
+			src: `package a
+type UserService interface {
+	GetById(req *Req) (*Resp, error)
+}`,
+			types:   []string{"UserService"},
+			wantErr: "UserService.GetById: the first parameter must be context.Context",
+		},
+		{
+			name: "no error",
+			src: `package a
+import "context"
+type UserService interface {
+	GetById(ctx context.Context, req *Req) *Resp
+}`,
+			types:   []string{"UserService"},
+			wantErr: "UserService.GetById: the last result must be error",
+		},
+		{
+			name: "not pointer",
+			src: `package a
+import "context"
+type UserService interface {
+	GetById(ctx context.Context, req Req) (*Resp, error)
+}`,
+			types:   []string{"UserService"},
+			wantErr: "UserService.GetById: request and response must be pointers, got Req",
+		},
+		{
+			name: "too many parameters",
+			src: `package a
+import "context"
+type UserService interface {
+	GetById(ctx context.Context, a, b *Req) (*Resp, error)
+}`,
+			types:   []string{"UserService"},
+			wantErr: "UserService.GetById: unsupported method signature",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := filepath.Join(t.TempDir(), "service.go")
+			require.NoError(t, os.WriteFile(source, []byte(tc.src), 0644))
+			_, err := generate(source, tc.types)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestGenerate_Imports(t *testing.T) {
+	src := `package a
+import (
+	"context"
+	"emicro/proto/gen"
+	xtime "time"
+)
+
+//rpc:service user
+type UserService interface {
+	Name() string
+	GetByIdProto(ctx context.Context, req *gen.GetByIdReq) (*gen.GetByIdResp, error)
+	Sleep(ctx context.Context, req *xtime.Duration) (*Resp, error)
+}`
+	source := filepath.Join(t.TempDir(), "service.go")
+	require.NoError(t, os.WriteFile(source, []byte(src), 0644))
+	code, err := generate(source, []string{"UserService"})
+	require.NoError(t, err)
+	assert.Contains(t, string(code), `import (
+	"context"
+	"emicro/proto/gen"
+	"emicro/rpc"
+	xtime "time"
+)`)
+	assert.Contains(t, string(code), `ServiceName: "user"`)
+	assert.Contains(t, string(code), `resp := new(gen.GetByIdResp)`)
+	assert.NotContains(t, string(code), `"Name"`)
+}
@@ -0,0 +1,41 @@
+// Package example shows the code generated by rpcgen, and makes sure it compiles and works.
+package example
+
+import (
+	"context"
+	"emicro/rpc"
+)
+
+//go:generate go run emicro/cmd/rpcgen -source=$GOFILE -type=UserService
+
+//rpc:service user-service
+type UserService interface {
+	GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error)
+	ListUsers(ctx context.Context, req *ListReq, stream rpc.ServerStream) error
+	Sum(ctx context.Context, stream rpc.ServerStream) (*SumResp, error)
+	Echo(ctx context.Context, stream rpc.ServerStream) error
+}
+
+type GetByIdReq struct {
+	Id int
+}
+
+type GetByIdResp struct {
+	Msg string
+}
+
+type ListReq struct {
+	Count int
+}
+
+type User struct {
+	Id int
+}
+
+type SumReq struct {
+	Val int
+}
+
+type SumResp struct {
+	Sum int
+}
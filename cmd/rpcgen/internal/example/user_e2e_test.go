@@ -0,0 +1,138 @@
+package example
+
+import (
+	"context"
+	"emicro/rpc"
+	"emicro/rpc/status"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type userService struct{}
+
+func (u *userService) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	if req.Id == 0 {
+		return nil, status.NewBizError("invalid id")
+	}
+	return &GetByIdResp{Msg: "hello, world"}, nil
+}
+
+func (u *userService) ListUsers(ctx context.Context, req *ListReq, stream rpc.ServerStream) error {
+	for i := 0; i < req.Count; i++ {
+		if err := stream.Send(&User{Id: i}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *userService) Sum(ctx context.Context, stream rpc.ServerStream) (*SumResp, error) {
+	res := &SumResp{}
+	for {
+		req := &SumReq{}
+		err := stream.Recv(req)
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Sum += req.Val
+	}
+}
+
+func (u *userService) Echo(ctx context.Context, stream rpc.ServerStream) error {
+	for {
+		req := &SumReq{}
+		err := stream.Recv(req)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(req); err != nil {
+			return err
+		}
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	server := rpc.NewServer()
+	require.NoError(t, RegisterUserServiceServer(server, &userService{}))
+	go func() {
+		err := server.Start(":8085")
+		t.Log(err)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	time.Sleep(time.Second * 3)
+
+	client, err := rpc.NewClient(":8085")
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	usClient := NewUserServiceClient(client)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	t.Run("unary", func(t *testing.T) {
+		resp, err := usClient.GetById(ctx, &GetByIdReq{Id: 123})
+		require.NoError(t, err)
+		assert.Equal(t, &GetByIdResp{Msg: "hello, world"}, resp)
+
+		_, err = usClient.GetById(ctx, &GetByIdReq{})
+		assert.Equal(t, status.NewBizError("invalid id"), err)
+	})
+
+	t.Run("server streaming", func(t *testing.T) {
+		stream, err := usClient.ListUsers(ctx, &ListReq{Count: 3})
+		require.NoError(t, err)
+		var ids []int
+		for {
+			user := &User{}
+			err = stream.Recv(user)
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			ids = append(ids, user.Id)
+		}
+		assert.Equal(t, []int{0, 1, 2}, ids)
+	})
+
+	t.Run("client streaming", func(t *testing.T) {
+		stream, err := usClient.Sum(ctx)
+		require.NoError(t, err)
+		for i := 1; i <= 3; i++ {
+			require.NoError(t, stream.Send(&SumReq{Val: i}))
+		}
+		require.NoError(t, stream.CloseSend())
+		resp := &SumResp{}
+		require.NoError(t, stream.Recv(resp))
+		assert.Equal(t, 6, resp.Sum)
+		assert.Equal(t, io.EOF, stream.Recv(resp))
+	})
+
+	t.Run("bidirectional streaming", func(t *testing.T) {
+		stream, err := usClient.Echo(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&SumReq{Val: 1}))
+		resp := &SumReq{}
+		require.NoError(t, stream.Recv(resp))
+		assert.Equal(t, 1, resp.Val)
+		require.NoError(t, stream.CloseSend())
+		assert.Equal(t, io.EOF, stream.Recv(resp))
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		err := client.Call(ctx, "user-service", "Unknown", &GetByIdReq{}, &GetByIdResp{})
+		assert.Equal(t, status.Unimplemented, status.CodeOf(err))
+	})
+}
@@ -0,0 +1,52 @@
+// rpcgen generates typed client stubs and server dispatch tables for the rpc package
+// from Go interfaces, so that neither reflect.MakeFunc nor method.Call is needed.
+//
+// Usage:
+//
+//	//go:generate go run emicro/cmd/rpcgen -source=$GOFILE -type=UserService
+//
+// The service name is the interface name,
+// or the value of the "//rpc:service" directive in the doc comment of the interface:
+//
+//	//rpc:service user-service
+//	type UserService interface {
+//		// unary
+//		GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error)
+//		// server-streaming
+//		ListUsers(ctx context.Context, req *ListReq, stream rpc.ServerStream) error
+//		// client-streaming
+//		Sum(ctx context.Context, stream rpc.ServerStream) (*SumResp, error)
+//		// bidirectional streaming
+//		Echo(ctx context.Context, stream rpc.ServerStream) error
+//	}
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	source := flag.String("source", "", "the Go file declaring the service interfaces")
+	destination := flag.String("destination", "", "the output file, default is <source>.rpc.go")
+	types := flag.String("type", "", "comma-separated list of the interface names")
+	flag.Parse()
+	if *source == "" || *types == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dst := *destination
+	if dst == "" {
+		dst = strings.TrimSuffix(*source, ".go") + ".rpc.go"
+	}
+	code, err := generate(*source, strings.Split(*types, ","))
+	if err == nil {
+		err = os.WriteFile(dst, code, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rpcgen: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -1,6 +1,6 @@
 module emicro
 
-go 1.18
+go 1.22
 
 require (
 	github.com/go-redis/redis/v9 v9.0.0-rc.2
@@ -9,7 +9,6 @@ require (
 	github.com/gotomicro/ekit v0.0.4
 	github.com/pierrec/lz4/v4 v4.1.17
 	github.com/prometheus/client_golang v1.11.1
-	github.com/silenceper/pool v1.0.0
 	github.com/stretchr/testify v1.9.0
 	go.etcd.io/etcd/api/v3 v3.5.6
 	go.etcd.io/etcd/client/v3 v3.5.6
@@ -1,13 +1,21 @@
 package codes
 
 import (
+	rpcstatus "emicro/rpc/status"
+
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 // Acceptable checks if given error is acceptable.
+// Errors of the custom rpc protocol are checked by their status code,
+// which has the same value as the gRPC code.
 func Acceptable(err error) bool {
-	switch status.Code(err) {
+	code := status.Code(err)
+	if se, ok := rpcstatus.FromError(err); ok {
+		code = codes.Code(se.Code)
+	}
+	switch code {
 	case codes.DeadlineExceeded, codes.Internal, codes.Unavailable, codes.DataLoss, codes.Unimplemented:
 		return false
 	default:
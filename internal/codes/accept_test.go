@@ -1,6 +1,7 @@
 package codes
 
 import (
+	rpcstatus "emicro/rpc/status"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -24,6 +25,16 @@ func TestAccept(t *testing.T) {
 			err:    status.Error(codes.DeadlineExceeded, "deadline"),
 			accept: false,
 		},
+		{
+			name:   "rpc unavailable error",
+			err:    rpcstatus.New(rpcstatus.Unavailable, "unavailable"),
+			accept: false,
+		},
+		{
+			name:   "rpc biz error",
+			err:    rpcstatus.NewBizError("user not found"),
+			accept: true,
+		},
 	}
 
 	for _, test := range tests {
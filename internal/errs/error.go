@@ -3,15 +3,41 @@ package errs
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var (
-	ServiceTypError     = errors.New("emicro: service type must be a first level pointer")
-	ReadLenDataError    = errors.New("emicro: could not read the length data")
-	ReadRespFailError   = errors.New("emicro: unable to read response")
-	InvalidServiceName  = errors.New("emicro: Invalid service name")
-	ClientNotAllWritten = errors.New("emicro: client not all data is written")
-	OnewayError         = errors.New("emicro: 这是 oneway 调用")
+	ServiceTypError          = errors.New("emicro: service type must be a first level pointer")
+	ServiceNilError          = errors.New("emicro: service can not be nil")
+	ReadLenDataError         = errors.New("emicro: could not read the length data")
+	ReadRespFailError        = errors.New("emicro: unable to read response")
+	InvalidServiceName       = errors.New("emicro: Invalid service name")
+	ClientNotAllWritten      = errors.New("emicro: client not all data is written")
+	OnewayError              = errors.New("emicro: 这是 oneway 调用")
+	ClientClosedError        = errors.New("emicro: client is closed")
+	StreamNotSupported       = errors.New("emicro: proxy does not support streaming calls")
+	StreamWindowError        = errors.New("emicro: the peer sends more messages than the stream window")
+	InvalidWindowUpdate      = errors.New("emicro: invalid stream window update")
+	ConnGoAwayError          = errors.New("emicro: connection is closed by server's goaway")
+	NoAvailableInstanceError = errors.New("emicro: no available service instance")
+	HeartbeatTimeoutError    = errors.New("emicro: heartbeat timeout, the peer is unresponsive")
+	InvalidHandshakeError    = errors.New("emicro: invalid handshake")
+	HandshakeRequiredError   = errors.New("emicro: the first frame of a connection must be a handshake")
+	ServerBusyError          = errors.New("emicro: server is busy")
+	InvalidMethodError       = errors.New("emicro: invalid service method")
+	InvalidJSONError         = errors.New("emicro: invalid JSON document")
+	RawDataTypeError         = errors.New("emicro: raw data must be []byte")
+)
+
+var (
+	FrameTruncatedError = errors.New("tcp: frame truncated")
+	FrameTooLargeError  = errors.New("tcp: frame too large")
+	FrameLengthError    = errors.New("tcp: invalid frame length")
+	MalformedFrameError = errors.New("tcp: malformed frame")
+)
+
+var (
+	DecompressTooLargeError = errors.New("compress: decompressed data too large")
 )
 
 var (
@@ -27,6 +53,83 @@ func ClientConnDeaded(err error) error {
 	return fmt.Errorf("emicro: client unable to get an available connection %w", err)
 }
 
+func ClientConnClosed(err error) error {
+	return fmt.Errorf("emicro: client connection is closed %w", err)
+}
+
+func DuplicateMessageId(id uint32) error {
+	return fmt.Errorf("emicro: message id %d is already in flight", id)
+}
+
+func StreamReset(reason string) error {
+	return fmt.Errorf("emicro: stream is reset by peer %s", reason)
+}
+
+func UnsupportedCodec(serializer, compressor uint8) error {
+	return fmt.Errorf("emicro: unsupported serializer %d or compressor %d", serializer, compressor)
+}
+
+func HandshakeFailed(reason string) error {
+	return fmt.Errorf("emicro: handshake failed: %s", reason)
+}
+
+func ProtocolVersionMismatch(want, got uint8) error {
+	return fmt.Errorf("emicro: protocol version mismatch, negotiated %d but got %d", want, got)
+}
+
 func NotFoundServiceMethod(methodName string) error {
 	return fmt.Errorf("server: 未找到目标服务方法 %s", methodName)
 }
+
+func FrameTooLarge(size uint64, maxSize uint32) error {
+	return fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", FrameTooLargeError, size, maxSize)
+}
+
+func DecompressTooLarge(maxSize int) error {
+	return fmt.Errorf("%w: exceeds the limit of %d bytes", DecompressTooLargeError, maxSize)
+}
+
+func InvalidFrameLength(size uint64) error {
+	return fmt.Errorf("%w: %d bytes", FrameLengthError, size)
+}
+
+func InvalidMetadata(key, value string) error {
+	return fmt.Errorf("emicro: invalid metadata %q: %q, the key can not be empty and neither can contain \\r or \\n", key, value)
+}
+
+func ReservedMetadata(key string) error {
+	return fmt.Errorf("emicro: metadata key %q is reserved by the framework", key)
+}
+
+func ServiceBusy(serviceName string) error {
+	return fmt.Errorf("%w: too many requests of service %s", ServerBusyError, serviceName)
+}
+
+func RequestTooLarge(reason string) error {
+	return fmt.Errorf("emicro: request exceeds the limit: %s", reason)
+}
+
+func MalformedFrame(reason string) error {
+	return fmt.Errorf("%w: %s", MalformedFrameError, reason)
+}
+
+func NoListener(address string) error {
+	return fmt.Errorf("transport: no listener on %s", address)
+}
+
+func AddressInUse(address string) error {
+	return fmt.Errorf("transport: address %s is already in use", address)
+}
+
+func InvalidServiceMethods(serviceName string, methods []string) error {
+	return fmt.Errorf("%w: service %s has %d invalid methods: %s",
+		InvalidMethodError, serviceName, len(methods), strings.Join(methods, "; "))
+}
+
+func MethodPanicked(serviceName, methodName string) error {
+	return fmt.Errorf("emicro: %s.%s panicked", serviceName, methodName)
+}
+
+func InvalidTimeout(timeout string) error {
+	return fmt.Errorf("gateway: invalid timeout %q", timeout)
+}
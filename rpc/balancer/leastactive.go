@@ -0,0 +1,72 @@
+package balancer
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"math"
+	"sync/atomic"
+)
+
+const LeastActive = "LEAST_ACTIVE"
+
+var (
+	_ Picker        = (*leastActivePicker)(nil)
+	_ PickerBuilder = (*LeastActiveBuilder)(nil)
+)
+
+type LeastActiveBuilder struct {
+	Filter Filter
+}
+
+func (b *LeastActiveBuilder) Build(nodes []Node) Picker {
+	actives := make([]*activeNode, 0, len(nodes))
+	for _, node := range nodes {
+		actives = append(actives, &activeNode{Node: node})
+	}
+	return &leastActivePicker{
+		nodes:  actives,
+		filter: filterOrDefault(b.Filter),
+	}
+}
+
+func (b *LeastActiveBuilder) Name() string {
+	return LeastActive
+}
+
+type leastActivePicker struct {
+	nodes  []*activeNode
+	filter Filter
+}
+
+func (p *leastActivePicker) Pick(ctx context.Context) (PickResult, error) {
+	// The disadvantage of using atomic operations is that they are not accurate enough,
+	// but a lock makes every call on the client contend for it
+	var leastActive int64 = math.MaxInt64
+	var res *activeNode
+	for _, node := range p.nodes {
+		if !p.filter(ctx, node.Instance()) {
+			continue
+		}
+		active := atomic.LoadInt64(&node.active)
+		if active < leastActive {
+			leastActive = active
+			res = node
+		}
+	}
+	if res == nil {
+		return PickResult{}, errs.NoAvailableInstanceError
+	}
+	atomic.AddInt64(&res.active, 1)
+	return PickResult{
+		Node: res.Node,
+		Done: func(err error) {
+			atomic.AddInt64(&res.active, -1)
+		},
+	}, nil
+}
+
+type activeNode struct {
+	Node
+	// the number of in-flight calls
+	active int64
+}
@@ -0,0 +1,203 @@
+package balancer
+
+import (
+	"context"
+	"emicro/internal/codes"
+	"emicro/internal/errs"
+	"emicro/internal/utils/xtime"
+	"emicro/rpc/status"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// P2C is the "power of two choices" algorithm with ewma,
+// the same algorithm as loadbalance/p2c of the gRPC path:
+// pick two nodes randomly and use the one with the lower load.
+// P2C 二选一算法，负载 = Sqrt(ewma 延迟) * (inflight + 1)
+const P2C = "p2c_ewma"
+
+const (
+	initSuccess     = 1000
+	throttleSuccess = initSuccess / 2
+	// If no statistical data is collected, we add a large latency penalty to this node.
+	penalty   = int64(math.MaxInt32)
+	forcePick = int64(time.Second)
+	pickTimes = 3
+	// 默认值来自 Finagle
+	decayTime = int64(time.Second * 10)
+)
+
+var (
+	_ Picker        = (*p2cPicker)(nil)
+	_ PickerBuilder = (*P2CBuilder)(nil)
+)
+
+type P2CBuilder struct {
+	Filter Filter
+}
+
+func (b *P2CBuilder) Build(nodes []Node) Picker {
+	stats := make([]*p2cNode, 0, len(nodes))
+	for _, node := range nodes {
+		stats = append(stats, &p2cNode{Node: node, success: initSuccess})
+	}
+	return &p2cPicker{
+		nodes:  stats,
+		filter: filterOrDefault(b.Filter),
+		r:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (b *P2CBuilder) Name() string {
+	return P2C
+}
+
+type p2cPicker struct {
+	nodes  []*p2cNode
+	filter Filter
+	// rand.Rand is not safe for concurrent use
+	lock sync.Mutex
+	r    *rand.Rand
+}
+
+func (p *p2cPicker) Pick(ctx context.Context) (PickResult, error) {
+	candidates := make([]*p2cNode, 0, len(p.nodes))
+	for _, node := range p.nodes {
+		if p.filter(ctx, node.Instance()) {
+			candidates = append(candidates, node)
+		}
+	}
+	var chosen *p2cNode
+	switch len(candidates) {
+	case 0:
+		return PickResult{}, errs.NoAvailableInstanceError
+	case 1:
+		chosen = p.choose(candidates[0], nil)
+	case 2:
+		chosen = p.choose(candidates[0], candidates[1])
+	default:
+		var node1, node2 *p2cNode
+		p.lock.Lock()
+		for i := 0; i < pickTimes; i++ {
+			idx1 := p.r.Intn(len(candidates))
+			idx2 := p.r.Intn(len(candidates) - 1)
+			if idx2 >= idx1 {
+				idx2++
+			}
+			node1 = candidates[idx1]
+			node2 = candidates[idx2]
+			if node1.healthy() && node2.healthy() {
+				break
+			}
+		}
+		p.lock.Unlock()
+		chosen = p.choose(node1, node2)
+	}
+	return PickResult{
+		Node: chosen.Node,
+		Done: p.buildCallback(chosen),
+	}, nil
+}
+
+func (p *p2cPicker) choose(c1, c2 *p2cNode) *p2cNode {
+	start := int64(xtime.Now())
+	if c2 == nil {
+		atomic.StoreInt64(&c1.pick, start)
+		return c1
+	}
+	if c1.load() > c2.load() {
+		c1, c2 = c2, c1
+	}
+	// a node failing fast has a low latency, the health takes precedence over the load
+	if !c1.healthy() && c2.healthy() {
+		c1, c2 = c2, c1
+	}
+	// 如果负载更大的节点在 forcePick 期间从未被选中过，则强制选择一次，
+	// 利用强制选择的机会触发成功率和延迟的更新
+	pick := atomic.LoadInt64(&c2.pick)
+	if start-pick > forcePick && atomic.CompareAndSwapInt64(&c2.pick, pick, start) {
+		return c2
+	}
+	atomic.StoreInt64(&c1.pick, start)
+	return c1
+}
+
+func (p *p2cPicker) buildCallback(c *p2cNode) func(err error) {
+	start := int64(xtime.Now())
+	atomic.AddInt64(&c.inflight, 1)
+	return func(err error) {
+		atomic.AddInt64(&c.inflight, -1)
+		now := int64(xtime.Now())
+		// the time interval since the last call finished
+		last := atomic.SwapInt64(&c.last, now)
+		td := now - last
+		if td < 0 {
+			td = 0
+		}
+		latency := now - start
+		if latency < 0 {
+			latency = 0
+		}
+		// the time decay coefficient, the attenuation function model in Newton's law
+		var w float64
+		oldLatency := atomic.LoadUint64(&c.latency)
+		if oldLatency != 0 {
+			w = math.Exp(float64(-td) / float64(decayTime))
+		}
+		atomic.StoreUint64(&c.latency, uint64(float64(oldLatency)*w+float64(latency)*(1-w)))
+		// business errors do not mean the node is unhealthy
+		success := initSuccess
+		if !acceptable(err) {
+			success = 0
+		}
+		oldSuccess := atomic.LoadUint64(&c.success)
+		atomic.StoreUint64(&c.success, uint64(float64(oldSuccess)*w+float64(success)*(1-w)))
+	}
+}
+
+// acceptable -> whether the node is still healthy after the call returned err
+// The errors without status code come from dialing or the connection, such as EOF,
+// so they count as failures unless the caller gave up the call itself.
+func acceptable(err error) bool {
+	if err == nil || status.IsBizError(err) || errors.Is(err, errs.OnewayError) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if _, ok := status.FromError(err); !ok {
+		return false
+	}
+	return codes.Acceptable(err)
+}
+
+type p2cNode struct {
+	Node
+	// 平均调用延迟（ewma）
+	latency uint64
+	// 请求成功数（ewma）
+	success uint64
+	// 节点当前正在处理的请求数
+	inflight int64
+	// 上次请求完成时间
+	last int64
+	// 上次选择的时间点
+	pick int64
+}
+
+func (c *p2cNode) healthy() bool {
+	return atomic.LoadUint64(&c.success) > throttleSuccess
+}
+
+// load -> Sqrt(ewma) * (inflight + 1)
+func (c *p2cNode) load() int64 {
+	// Add 1 to avoid zero
+	latency := int64(math.Sqrt(float64(atomic.LoadUint64(&c.latency) + 1)))
+	load := latency * (atomic.LoadInt64(&c.inflight) + 1)
+	if load == 0 {
+		return penalty
+	}
+	return load
+}
@@ -0,0 +1,230 @@
+package balancer
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"emicro/registry"
+	"emicro/rpc/status"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testNode registry.ServiceInstance
+
+func (n testNode) Instance() registry.ServiceInstance {
+	return registry.ServiceInstance(n)
+}
+
+func newNodes(instances ...registry.ServiceInstance) []Node {
+	nodes := make([]Node, 0, len(instances))
+	for _, ins := range instances {
+		nodes = append(nodes, testNode(ins))
+	}
+	return nodes
+}
+
+func pickAddresses(t *testing.T, p Picker, ctx context.Context, n int) []string {
+	res := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		pr, err := p.Pick(ctx)
+		require.NoError(t, err)
+		res = append(res, pr.Node.Instance().Address)
+		if pr.Done != nil {
+			pr.Done(nil)
+		}
+	}
+	return res
+}
+
+func TestNoAvailableInstance(t *testing.T) {
+	builders := []PickerBuilder{
+		&RoundRobinBuilder{},
+		&WeightRandomBuilder{},
+		&LeastActiveBuilder{},
+		&P2CBuilder{},
+	}
+	for _, b := range builders {
+		t.Run(b.Name(), func(t *testing.T) {
+			_, err := b.Build(nil).Pick(context.Background())
+			assert.Equal(t, errs.NoAvailableInstanceError, err)
+
+			// all instances are filtered out
+			p := (&RoundRobinBuilder{Filter: GroupFilter}).Build(newNodes(
+				registry.ServiceInstance{Address: "127.0.0.1:8080", Group: "A"}))
+			_, err = p.Pick(context.WithValue(context.Background(), "group", "B"))
+			assert.Equal(t, errs.NoAvailableInstanceError, err)
+		})
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	nodes := newNodes(
+		registry.ServiceInstance{Address: "127.0.0.1:8080", Group: "A"},
+		registry.ServiceInstance{Address: "127.0.0.1:8081", Group: "B"},
+		registry.ServiceInstance{Address: "127.0.0.1:8082", Group: "A"},
+	)
+	testCases := []struct {
+		name    string
+		builder *RoundRobinBuilder
+		ctx     context.Context
+		want    []string
+	}{
+		{
+			name:    "all",
+			builder: &RoundRobinBuilder{},
+			ctx:     context.Background(),
+			want:    []string{"127.0.0.1:8080", "127.0.0.1:8081", "127.0.0.1:8082", "127.0.0.1:8080"},
+		},
+		{
+			name:    "group",
+			builder: &RoundRobinBuilder{Filter: GroupFilter},
+			ctx:     context.WithValue(context.Background(), "group", "A"),
+			want:    []string{"127.0.0.1:8080", "127.0.0.1:8082", "127.0.0.1:8080"},
+		},
+		{
+			name:    "no group in context",
+			builder: &RoundRobinBuilder{Filter: GroupFilter},
+			ctx:     context.Background(),
+			want:    []string{"127.0.0.1:8080", "127.0.0.1:8081", "127.0.0.1:8082"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := tc.builder.Build(nodes)
+			assert.Equal(t, tc.want, pickAddresses(t, p, tc.ctx, len(tc.want)))
+		})
+	}
+}
+
+func TestWeightRandom(t *testing.T) {
+	testCases := []struct {
+		name      string
+		instances []registry.ServiceInstance
+		want      map[string]bool
+	}{
+		{
+			name: "zero weight is never picked",
+			instances: []registry.ServiceInstance{
+				{Address: "127.0.0.1:8080", Weight: 0},
+				{Address: "127.0.0.1:8081", Weight: 10},
+			},
+			want: map[string]bool{"127.0.0.1:8081": true},
+		},
+		{
+			name: "no weight",
+			instances: []registry.ServiceInstance{
+				{Address: "127.0.0.1:8080"},
+				{Address: "127.0.0.1:8081"},
+			},
+			want: map[string]bool{"127.0.0.1:8080": true, "127.0.0.1:8081": true},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := (&WeightRandomBuilder{}).Build(newNodes(tc.instances...))
+			got := make(map[string]bool, len(tc.want))
+			for _, address := range pickAddresses(t, p, context.Background(), 200) {
+				got[address] = true
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLeastActive(t *testing.T) {
+	p := (&LeastActiveBuilder{}).Build(newNodes(
+		registry.ServiceInstance{Address: "127.0.0.1:8080"},
+		registry.ServiceInstance{Address: "127.0.0.1:8081"},
+	))
+	first, err := p.Pick(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8080", first.Node.Instance().Address)
+	// the first one is still running
+	second, err := p.Pick(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8081", second.Node.Instance().Address)
+
+	first.Done(nil)
+	third, err := p.Pick(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8080", third.Node.Instance().Address)
+}
+
+func TestP2C(t *testing.T) {
+	p := (&P2CBuilder{}).Build(newNodes(
+		registry.ServiceInstance{Address: "127.0.0.1:8080"},
+		registry.ServiceInstance{Address: "127.0.0.1:8081"},
+	)).(*p2cPicker)
+
+	res, err := p.Pick(context.Background())
+	require.NoError(t, err)
+	node := res.Node.Instance().Address
+	stats := p.nodes[0]
+	if stats.Instance().Address != node {
+		stats = p.nodes[1]
+	}
+	assert.Equal(t, int64(1), stats.inflight)
+
+	// business errors do not make the node unhealthy
+	res.Done(status.NewBizError("mock error"))
+	assert.Equal(t, int64(0), stats.inflight)
+	assert.True(t, stats.healthy())
+
+	res, err = p.Pick(context.Background())
+	require.NoError(t, err)
+	res.Done(status.New(status.Unavailable, "mock error"))
+	assert.Equal(t, 4, len(pickAddresses(t, p, context.Background(), 4)))
+}
+
+func TestP2C_ConnectionError(t *testing.T) {
+	testCases := []struct {
+		name        string
+		err         error
+		wantHealthy bool
+	}{
+		{name: "no error", wantHealthy: true},
+		{name: "business error", err: status.NewBizError("mock error"), wantHealthy: true},
+		{name: "acceptable status", err: status.New(status.NotFound, "mock error"), wantHealthy: true},
+		{name: "unavailable", err: status.New(status.Unavailable, "mock error")},
+		{name: "connection closed", err: errs.ClientConnClosed(io.EOF)},
+		{name: "dial failed", err: errs.ClientConnDeaded(&net.OpError{Op: "dial", Err: errors.New("connection refused")})},
+		{name: "cancelled by the caller", err: context.Canceled, wantHealthy: true},
+		{name: "oneway", err: errs.OnewayError, wantHealthy: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := (&P2CBuilder{}).Build(newNodes(registry.ServiceInstance{Address: "127.0.0.1:8080"})).(*p2cPicker)
+			res, err := p.Pick(context.Background())
+			require.NoError(t, err)
+			res.Done(tc.err)
+			assert.Equal(t, tc.wantHealthy, p.nodes[0].healthy())
+		})
+	}
+
+	// the node returning connection errors is not picked anymore, although it fails fast
+	p := (&P2CBuilder{}).Build(newNodes(
+		registry.ServiceInstance{Address: "127.0.0.1:8080"},
+		registry.ServiceInstance{Address: "127.0.0.1:8081"},
+	)).(*p2cPicker)
+	for i := 0; i < 10; i++ {
+		res, err := p.Pick(context.Background())
+		require.NoError(t, err)
+		if res.Node.Instance().Address == "127.0.0.1:8080" {
+			res.Done(errs.ClientConnClosed(io.EOF))
+			continue
+		}
+		res.Done(nil)
+	}
+	assert.False(t, p.nodes[0].healthy())
+	for i := 0; i < 10; i++ {
+		res, err := p.Pick(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:8081", res.Node.Instance().Address)
+		res.Done(nil)
+	}
+}
@@ -0,0 +1,65 @@
+package balancer
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"math/rand"
+)
+
+const WeightRandom = "WEIGHT_RANDOM"
+
+var (
+	_ Picker        = (*weightRandomPicker)(nil)
+	_ PickerBuilder = (*WeightRandomBuilder)(nil)
+)
+
+// WeightRandomBuilder -> pick randomly according to ServiceInstance.Weight
+// Instances without weight are picked only when all candidates have no weight.
+type WeightRandomBuilder struct {
+	Filter Filter
+}
+
+func (b *WeightRandomBuilder) Build(nodes []Node) Picker {
+	return &weightRandomPicker{
+		nodes:  nodes,
+		filter: filterOrDefault(b.Filter),
+	}
+}
+
+func (b *WeightRandomBuilder) Name() string {
+	return WeightRandom
+}
+
+type weightRandomPicker struct {
+	nodes  []Node
+	filter Filter
+}
+
+func (p *weightRandomPicker) Pick(ctx context.Context) (PickResult, error) {
+	candidates := make([]Node, 0, len(p.nodes))
+	var totalWeight uint64
+	for _, node := range p.nodes {
+		ins := node.Instance()
+		if !p.filter(ctx, ins) {
+			continue
+		}
+		candidates = append(candidates, node)
+		totalWeight += uint64(ins.Weight)
+	}
+	if len(candidates) == 0 {
+		return PickResult{}, errs.NoAvailableInstanceError
+	}
+	if totalWeight == 0 {
+		return PickResult{Node: candidates[rand.Intn(len(candidates))]}, nil
+	}
+	val := uint64(rand.Int63n(int64(totalWeight)))
+	for _, node := range candidates {
+		weight := uint64(node.Instance().Weight)
+		if val < weight {
+			return PickResult{Node: node}, nil
+		}
+		val -= weight
+	}
+	// In fact, it is impossible to run here, because we must be able to find a value before
+	return PickResult{}, errs.NoAvailableInstanceError
+}
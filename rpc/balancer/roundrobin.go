@@ -0,0 +1,53 @@
+package balancer
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"sync"
+)
+
+const RoundRobin = "ROUND_ROBIN"
+
+var (
+	_ Picker        = (*roundRobinPicker)(nil)
+	_ PickerBuilder = (*RoundRobinBuilder)(nil)
+)
+
+type RoundRobinBuilder struct {
+	Filter Filter
+}
+
+func (b *RoundRobinBuilder) Build(nodes []Node) Picker {
+	return &roundRobinPicker{
+		nodes:  nodes,
+		filter: filterOrDefault(b.Filter),
+	}
+}
+
+func (b *RoundRobinBuilder) Name() string {
+	return RoundRobin
+}
+
+type roundRobinPicker struct {
+	mutex  sync.Mutex
+	cnt    uint64
+	nodes  []Node
+	filter Filter
+}
+
+func (p *roundRobinPicker) Pick(ctx context.Context) (PickResult, error) {
+	candidates := make([]Node, 0, len(p.nodes))
+	for _, node := range p.nodes {
+		if p.filter(ctx, node.Instance()) {
+			candidates = append(candidates, node)
+		}
+	}
+	if len(candidates) == 0 {
+		return PickResult{}, errs.NoAvailableInstanceError
+	}
+	p.mutex.Lock()
+	index := p.cnt % uint64(len(candidates))
+	p.cnt++
+	p.mutex.Unlock()
+	return PickResult{Node: candidates[index]}, nil
+}
@@ -0,0 +1,58 @@
+package balancer
+
+import (
+	"context"
+	"emicro/registry"
+)
+
+// Node -> an instance which the client can send calls to
+type Node interface {
+	Instance() registry.ServiceInstance
+}
+
+// PickResult -> the chosen node of a call
+type PickResult struct {
+	Node Node
+	// Done is called when the call finishes, err is nil if the call succeeded.
+	// It is used to design a feedback load balancing strategy, and it can be nil.
+	Done func(err error)
+}
+
+// Picker -> choose a node for every call
+// Picker must be safe for concurrent use.
+type Picker interface {
+	Pick(ctx context.Context) (PickResult, error)
+}
+
+// PickerBuilder -> build a new Picker whenever the instances of the service change
+// It's the same as base.PickerBuilder of gRPC.
+type PickerBuilder interface {
+	Build(nodes []Node) Picker
+	Name() string
+}
+
+// Filter -> whether the instance can be used by the call
+type Filter func(ctx context.Context, ins registry.ServiceInstance) bool
+
+// GroupFilter -> only use the instances in the group carried by ctx,
+// the same as loadbalance.GroupFilter of the gRPC path
+func GroupFilter(ctx context.Context, ins registry.ServiceInstance) bool {
+	group := ctx.Value("group")
+	if group == nil {
+		// There are no groups here, but all groups can be used
+		return true
+	}
+	input, _ := group.(string)
+	return input == ins.Group
+}
+
+func allowAll(ctx context.Context, ins registry.ServiceInstance) bool {
+	return true
+}
+
+func filterOrDefault(filter Filter) Filter {
+	if filter == nil {
+		return allowAll
+	}
+	return filter
+}
@@ -0,0 +1,27 @@
+package rpc
+
+import "sync"
+
+// maxPooledBufferSize -> the larger buffers are left to GC, so that a few huge frames
+// don't keep the memory forever
+const maxPooledBufferSize = 64 << 10
+
+// bufferPool -> buffers for encoding the headers of frames
+var bufferPool = sync.Pool{
+	New: func() any {
+		bs := make([]byte, 0, 256)
+		return &bs
+	},
+}
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func putBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBufferSize {
+		return
+	}
+	*buf = (*buf)[:0]
+	bufferPool.Put(buf)
+}
@@ -2,34 +2,81 @@ package rpc
 
 import (
 	"context"
+	"crypto/tls"
 	"emicro/internal/errs"
+	"emicro/registry"
+	"emicro/rpc/balancer"
 	"emicro/rpc/compress"
 	message2 "emicro/rpc/message"
+	"emicro/rpc/metadata"
 	"emicro/rpc/serialize"
 	"emicro/rpc/serialize/json"
+	"emicro/rpc/status"
 	"emicro/rpc/tcp"
-	"errors"
+	"emicro/rpc/transport"
+	"fmt"
 	"github.com/gotomicro/ekit/bean/option"
-	"github.com/silenceper/pool"
-	"net"
 	"reflect"
 	"strconv"
 	"sync/atomic"
 	"time"
 )
 
-var _ Proxy = (*Client)(nil)
+var (
+	_ Proxy       = (*Client)(nil)
+	_ StreamProxy = (*Client)(nil)
+	_ Caller      = (*Client)(nil)
+)
 
 type ClientOption func(client *Client)
 
 // messageId
 var messageId uint32 = 0
 
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
 // Client -> tcp conn client
+// It calls a fixed address, or the instances of a service found in the registry.
 type Client struct {
-	connPool   pool.Pool
+	// connections to the fixed address, nil if the registry is used
+	connPool *connPool
+	// connections to the instances, nil if the fixed address is used
+	resolver *resolver
+
+	registry        registry.Registry
+	registryTimeout time.Duration
+	pickerBuilder   balancer.PickerBuilder
+
 	serializer serialize.Serializer
 	compressor compress.Compressor
+	// the request data smaller than it is not compressed, 0 means always compress
+	compressThreshold int
+	// the maximum size of a response frame
+	maxFrameSize uint32
+	// the maximum number of multiplexed connections
+	maxConns int
+	// 0 means heartbeat is disabled
+	heartbeatInterval time.Duration
+	heartbeatTimeout  time.Duration
+	// TCP by default
+	transport transport.Transport
+	// nil means no TLS
+	tlsConfig *tls.Config
+
+	// the codecs of the responses besides the ones of the requests, in preference order
+	acceptedSerializers []serialize.Serializer
+	acceptedCompressors []compress.Compressor
+
+	// retry policies of the services and methods, keyed by "service" or "service/method"
+	retryPolicies      map[string]RetryPolicy
+	defaultRetryPolicy RetryPolicy
+
+	interceptors []UnaryClientInterceptor
+	// invokeWithRetry wrapped by interceptors
+	invoker UnaryInvoker
 }
 
 // InitClientProxy -> init client proxy
@@ -52,11 +99,15 @@ func (c *Client) InitService(srv Service) error {
 // setFuncField
 func setFuncField(serializer serialize.Serializer,
 	compress compress.Compressor, service Service, proxy Proxy) error {
-	srvValElem := reflect.ValueOf(service).Elem()
-	srvTypElem := srvValElem.Type()
-	if srvTypElem.Kind() == reflect.Ptr {
+	if service == nil {
+		return errs.ServiceNilError
+	}
+	srvVal := reflect.ValueOf(service)
+	if srvVal.Kind() != reflect.Ptr || srvVal.Elem().Kind() != reflect.Struct {
 		return errs.ServiceTypError
 	}
+	srvValElem := srvVal.Elem()
+	srvTypElem := srvValElem.Type()
 	numField := srvTypElem.NumField()
 	for i := 0; i < numField; i++ {
 		//fieldTyp := srvTypElem.Field(i).Type
@@ -66,71 +117,24 @@ func setFuncField(serializer serialize.Serializer,
 		if !fieldVal.CanSet() {
 			continue
 		}
-		fn := func(args []reflect.Value) (results []reflect.Value) {
-			in := args[1].Interface()
-			// out := reflect.New(fieldTyp.Type.Out(0).Elem()).Interface()
-			// out := reflect.Zero(structField.Type.Out(0))
-			out := reflect.New(structField.Type.Out(0).Elem())
-			// serialize request data
-			reqData, err := serializer.Encode(in)
-			if err != nil {
-				return []reflect.Value{out, reflect.ValueOf(err)}
-			}
-			// compress response data
-			reqData, err = compress.Compress(reqData)
-			if err != nil {
-				return []reflect.Value{out, reflect.ValueOf(err)}
+		if isStreamFunc(structField.Type) {
+			streamProxy, ok := proxy.(StreamProxy)
+			if !ok {
+				return errs.StreamNotSupported
 			}
+			fieldVal.Set(reflect.MakeFunc(structField.Type,
+				streamFunc(serializer, compress, service.Name(), structField.Name, structField.Type, streamProxy)))
+			continue
+		}
+		fn := func(args []reflect.Value) (results []reflect.Value) {
 			ctx := args[0].Interface().(context.Context)
-			// For the time being, write it dead first.
-			//Later, we will consider the general link metadata transmission and reconstruction
-			var meta map[string]string
-			if isOneway(ctx) {
-				meta = map[string]string{"one-way": "true"}
-			}
-			if deadline, ok := ctx.Deadline(); ok {
-				// More space is required for string transmission
-				meta["deadline"] = strconv.FormatInt(deadline.UnixMilli(), 10)
-			}
-			req := &message2.Request{
-				Meta:        meta,
-				Compresser:  compress.Code(),
-				Serializer:  serializer.Code(),
-				ServiceName: service.Name(),
-				MethodName:  structField.Name,
-				MessageId:   atomic.AddUint32(&messageId, +1),
-			}
-			// calculate and set the request head length
-			req.CalculateHeaderLength()
-			// calculate and set the request body length
-			req.CalculateBodyLength()
-			resp, err := proxy.Invoke(ctx, req)
+			out := reflect.New(structField.Type.Out(0).Elem())
+			err := call(ctx, serializer, compress, proxy, service.Name(), structField.Name,
+				args[1].Interface(), out.Interface())
+			// MakeFunc does not accept the zero Value, so a nil error must be typed
+			errVal := reflect.Zero(errorType)
 			if err != nil {
-				return []reflect.Value{out, reflect.ValueOf(err)}
-			}
-			var respErr error
-			if len(resp.Error) > 0 {
-				respErr = errors.New(string(resp.Error))
-			}
-			if len(resp.Data) > 0 {
-				//out := reflect.Zero(structField.Type.Out(0))
-				var data []byte
-				// decompress response data
-				data, err = compress.UnCompress(resp.Data)
-				if err != nil {
-					return []reflect.Value{out, reflect.ValueOf(err)}
-				}
-				// deserialize response data
-				err = serializer.Decode(data, out.Interface())
-				if err != nil {
-					return []reflect.Value{out, reflect.ValueOf(err)}
-				}
-			}
-			var errVal reflect.Value
-			if respErr == nil {
-
-			} else {
-				errVal = reflect.ValueOf(respErr)
+				errVal = reflect.ValueOf(err)
 			}
 			return []reflect.Value{out, errVal}
 		}
@@ -139,56 +143,260 @@ func setFuncField(serializer serialize.Serializer,
 	return nil
 }
 
+// isStreamFunc -> streaming calls return a ClientStream
+// server-streaming: func(ctx context.Context, req *Req) (ClientStream, error)
+// client-streaming and bidirectional streaming: func(ctx context.Context) (ClientStream, error)
+func isStreamFunc(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Func && typ.NumOut() == 2 && typ.Out(0) == clientStreamType
+}
+
+// streamFunc -> open the stream, the server-streaming call also sends its only request
+func streamFunc(serializer serialize.Serializer, compress compress.Compressor,
+	serviceName, methodName string, typ reflect.Type, proxy StreamProxy) func(args []reflect.Value) []reflect.Value {
+	return func(args []reflect.Value) []reflect.Value {
+		ctx := args[0].Interface().(context.Context)
+		stream, err := openStream(ctx, serializer, compress, proxy, serviceName, methodName)
+		if err == nil && typ.NumIn() == 2 {
+			err = SendOnly(stream, args[1].Interface())
+		}
+		if err != nil {
+			return []reflect.Value{reflect.Zero(clientStreamType), reflect.ValueOf(err)}
+		}
+		return []reflect.Value{reflect.ValueOf(&stream).Elem(), reflect.Zero(errorType)}
+	}
+}
+
+// call -> encode in, invoke the method and decode the response into out
+// The service may return both data and error, so out is filled even if an error is returned.
+func call(ctx context.Context, serializer serialize.Serializer, compress compress.Compressor,
+	proxy Proxy, serviceName, methodName string, in, out any) error {
+	serializer, compress = callCodecs(ctx, serializer, compress)
+	// serialize request data
+	reqData, err := serializer.Encode(in)
+	if err != nil {
+		return err
+	}
+	// compress request data, the server responds with the same compressor unless the client accepts others
+	compress = chooseCompressor(compress, len(reqData))
+	reqData, err = compress.Compress(reqData)
+	if err != nil {
+		return err
+	}
+	req, err := newRequest(ctx, serializer, compress, serviceName, methodName, reqData)
+	if err != nil {
+		return err
+	}
+	serializers, compressors := acceptCodecs(proxy, req, serializer)
+	resp, err := proxy.Invoke(ctx, req)
+	if err != nil {
+		return err
+	}
+	respErr := responseError(resp)
+	if len(resp.Data) > 0 {
+		respSerializer, respCompressor, err := responseCodecs(resp, serializer, compress, serializers, compressors)
+		if err != nil {
+			return err
+		}
+		// decompress response data
+		data, err := respCompressor.UnCompress(resp.Data)
+		if err != nil {
+			return err
+		}
+		// deserialize response data
+		if err = respSerializer.Decode(data, out); err != nil {
+			return err
+		}
+	}
+	return respErr
+}
+
+// thresholdCompressor -> the payloads smaller than threshold are not compressed,
+// see ClientWithCompressThreshold
+type thresholdCompressor struct {
+	compress.Compressor
+	threshold int
+}
+
+// chooseCompressor -> the compressor of a unary call with size bytes of request data
+func chooseCompressor(c compress.Compressor, size int) compress.Compressor {
+	tc, ok := c.(thresholdCompressor)
+	if !ok {
+		return c
+	}
+	if size < tc.threshold {
+		return compress.DoNothingCompressor{}
+	}
+	return tc.Compressor
+}
+
+// openStream -> send the stream open frame
+func openStream(ctx context.Context, serializer serialize.Serializer, compress compress.Compressor,
+	proxy StreamProxy, serviceName, methodName string) (ClientStream, error) {
+	serializer, compress = callCodecs(ctx, serializer, compress)
+	req, err := newRequest(ctx, serializer, compress, serviceName, methodName, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.MessageType = message2.MessageTypeStreamOpen
+	return proxy.NewStream(ctx, req)
+}
+
+// SendOnly -> send the only request of a server-streaming call
+// The stream is reset if it fails, otherwise it stays open on the connection and the server.
+func SendOnly(stream ClientStream, in any) error {
+	err := stream.Send(in)
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	if err != nil {
+		if s, ok := stream.(*clientStream); ok {
+			s.reset(err)
+		}
+	}
+	return err
+}
+
+// newRequest -> build the request with metadata and lengths
+// The outgoing metadata in ctx is copied into Request.Meta, along with the framework keys.
+func newRequest(ctx context.Context, serializer serialize.Serializer, compress compress.Compressor,
+	serviceName, methodName string, data []byte) (*message2.Request, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if err := metadata.Validate(md); err != nil {
+		return nil, err
+	}
+	meta := make(map[string]string, len(md)+2)
+	for k, v := range md {
+		if isReservedMeta(k) {
+			return nil, errs.ReservedMetadata(k)
+		}
+		meta[k] = v
+	}
+	if isOneway(ctx) {
+		meta[metaOneway] = "true"
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		// More space is required for string transmission
+		meta[metaDeadline] = strconv.FormatInt(deadline.UnixMilli(), 10)
+	}
+	req := &message2.Request{
+		Meta:        meta,
+		Version:     message2.ProtocolVersion,
+		Compresser:  compress.Code(),
+		Serializer:  serializer.Code(),
+		ServiceName: serviceName,
+		MethodName:  methodName,
+		MessageId:   atomic.AddUint32(&messageId, +1),
+		Data:        data,
+	}
+	// calculate and set the request head length
+	req.CalculateHeaderLength()
+	// calculate and set the request body length
+	req.CalculateBodyLength()
+	return req, nil
+}
+
+// checkLimits -> the server closes the connection on which a request exceeds the limits of the frame,
+// failing the other calls on it too, so the request is rejected before it's written
+func checkLimits(req *message2.Request) error {
+	if err := req.CheckLimits(); err != nil {
+		return status.New(status.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
 // Invoke -> invoke rpc service
+// Calls are multiplexed over the connections, so the caller is blocked
+// only by its own response instead of the ones sent before it.
 func (c *Client) Invoke(ctx context.Context, request *message2.Request) (*message2.Response, error) {
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
 	}
-	var (
-		resp *message2.Response
-		err  error
-	)
-	ch := make(chan struct{})
-	go func() {
-		encode := message2.EncodeReq(request)
-		resp, err = c.doInvoke(ctx, encode)
-		ch <- struct{}{}
-		close(ch)
-	}()
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-ch:
-		return resp, err
+	if request.MessageId == 0 {
+		request.MessageId = atomic.AddUint32(&messageId, +1)
 	}
+	return c.invoker(ctx, request)
+}
+
+// Call -> invoke the method with typed request and response, used by the generated stubs
+func (c *Client) Call(ctx context.Context, serviceName, methodName string, in, out any) error {
+	return call(ctx, c.serializer, c.compressor, c, serviceName, methodName, in, out)
+}
+
+// Stream -> open a streaming call, used by the generated stubs
+// The server-streaming call must send its only request and then call CloseSend.
+func (c *Client) Stream(ctx context.Context, serviceName, methodName string) (ClientStream, error) {
+	return openStream(ctx, c.serializer, c.compressor, c, serviceName, methodName)
 }
 
 // doInvoke -> invoke rpc service
-func (c *Client) doInvoke(ctx context.Context, encode []byte) (*message2.Response, error) {
-	val, err := c.connPool.Get()
+func (c *Client) doInvoke(ctx context.Context, request *message2.Request) (*message2.Response, error) {
+	if err := checkLimits(request); err != nil {
+		return nil, err
+	}
+	conn, done, err := c.getConn(ctx)
 	if err != nil {
-		return nil, errs.ClientConnDeaded(err)
+		return nil, unsentError{err: errs.ClientConnDeaded(err)}
+	}
+	resp, err := conn.call(ctx, request)
+	if err == nil {
+		done(responseError(resp))
+	} else {
+		done(err)
+	}
+	return resp, err
+}
+
+// getConn -> get a connection to the fixed address or to the instance picked by the balancer,
+// done must be called when the call finishes
+func (c *Client) getConn(ctx context.Context) (*clientConn, func(err error), error) {
+	if c.resolver == nil {
+		conn, err := c.connPool.Get(ctx)
+		return conn, func(err error) {}, err
 	}
-	// put back
-	defer func() {
-		_ = c.connPool.Put(val)
-	}()
-	conn := val.(net.Conn)
-	l, err := conn.Write(encode)
+	pool, done, err := c.resolver.pick(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	if l != len(encode) {
-		return nil, errs.ClientNotAllWritten
+	conn, err := pool.Get(ctx)
+	if err != nil {
+		done(err)
+		return nil, nil, err
 	}
-	if isOneway(ctx) {
-		return nil, errs.OnewayError
+	return conn, done, nil
+}
+
+// NewStream -> open a stream, request is the stream open frame
+func (c *Client) NewStream(ctx context.Context, request *message2.Request) (ClientStream, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if request.MessageId == 0 {
+		request.MessageId = atomic.AddUint32(&messageId, +1)
+	}
+	request.MessageType = message2.MessageTypeStreamOpen
+	if err := checkLimits(request); err != nil {
+		return nil, err
+	}
+	conn, done, err := c.getConn(ctx)
+	if err != nil {
+		return nil, errs.ClientConnDeaded(err)
 	}
-	data, err := tcp.ReadMsg(conn)
+	// the open frame is built with the codecs in ctx, the messages must be encoded with them too
+	serializer, compressor := callCodecs(ctx, c.serializer, c.compressor)
+	// done is called when the stream finishes
+	stream, err := conn.newStream(ctx, request, serializer, compressor, done)
 	if err != nil {
-		return nil, errs.ReadRespFailError
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Close -> close all connections
+func (c *Client) Close() error {
+	if c.resolver != nil {
+		return c.resolver.Close()
 	}
-	return message2.DecodeResp(data), nil
+	return c.connPool.Close()
 }
 
 // ClientWithSerializer -> option
@@ -205,32 +413,211 @@ func ClientWithCompressor(c compress.Compressor) option.Option[Client] {
 	}
 }
 
+// ClientWithAcceptedSerializers -> the server may encode the responses by the first of serializers it registers,
+// instead of the serializer of the request
+func ClientWithAcceptedSerializers(serializers ...serialize.Serializer) option.Option[Client] {
+	return func(client *Client) {
+		client.acceptedSerializers = append(client.acceptedSerializers, serializers...)
+	}
+}
+
+// ClientWithAcceptedCompressors -> the server may compress the responses by the first of compressors it registers,
+// instead of the compressor of the request, e.g. the small requests are not compressed but the responses may be large
+func ClientWithAcceptedCompressors(compressors ...compress.Compressor) option.Option[Client] {
+	return func(client *Client) {
+		client.acceptedCompressors = append(client.acceptedCompressors, compressors...)
+	}
+}
+
+// ClientWithCompressThreshold -> the request data smaller than size bytes is not compressed,
+// it's sent with code 0 (DoNothingCompressor) so that tiny payloads don't pay the framing overhead.
+// It applies to unary calls, messages of streaming calls are always compressed.
+func ClientWithCompressThreshold(size int) option.Option[Client] {
+	return func(client *Client) {
+		client.compressThreshold = size
+	}
+}
+
+// ClientWithMaxFrameSize -> option
+func ClientWithMaxFrameSize(size uint32) option.Option[Client] {
+	return func(client *Client) {
+		client.maxFrameSize = size
+	}
+}
+
+// ClientWithMaxConns -> option
+func ClientWithMaxConns(n int) option.Option[Client] {
+	return func(client *Client) {
+		client.maxConns = n
+	}
+}
+
+// ClientWithHeartbeat -> ping every connection every interval,
+// the connection is closed and removed from the pool if the server does not answer within timeout
+func ClientWithHeartbeat(interval, timeout time.Duration) option.Option[Client] {
+	return func(client *Client) {
+		client.heartbeatInterval = interval
+		client.heartbeatTimeout = timeout
+	}
+}
+
+// ClientWithTLS -> connect to the server with TLS
+// Set config.Certificates for mutual TLS, config.ServerName defaults to the host of the address.
+func ClientWithTLS(config *tls.Config) option.Option[Client] {
+	return func(client *Client) {
+		client.tlsConfig = config
+	}
+}
+
+// ClientWithTransport -> how to connect to the server, e.g. transport.Unix{} or a transport.Memory
+// shared with the server, default is TCP
+func ClientWithTransport(t transport.Transport) option.Option[Client] {
+	return func(client *Client) {
+		client.transport = t
+	}
+}
+
+// ClientWithInterceptors -> option
+// The interceptors run in order, the first one is the outermost.
+func ClientWithInterceptors(interceptors ...UnaryClientInterceptor) option.Option[Client] {
+	return func(client *Client) {
+		client.interceptors = append(client.interceptors, interceptors...)
+	}
+}
+
+// ClientWithRetryPolicy -> the retry policy of all the methods,
+// unless they have their own ones set by ClientWithMethodRetryPolicy
+func ClientWithRetryPolicy(policy RetryPolicy) option.Option[Client] {
+	return func(client *Client) {
+		client.defaultRetryPolicy = policy
+	}
+}
+
+// ClientWithMethodRetryPolicy -> the retry policy of the method,
+// empty methodName means all the methods of the service
+func ClientWithMethodRetryPolicy(serviceName, methodName string, policy RetryPolicy) option.Option[Client] {
+	return func(client *Client) {
+		if client.retryPolicies == nil {
+			client.retryPolicies = make(map[string]RetryPolicy, 4)
+		}
+		key := serviceName
+		if methodName != "" {
+			key = serviceName + "/" + methodName
+		}
+		client.retryPolicies[key] = policy
+	}
+}
+
+// ClientWithRegistry -> discover the instances of the service from the registry,
+// the address of NewClient is the service name then.
+// timeout is used when listing the instances.
+func ClientWithRegistry(r registry.Registry, timeout time.Duration) option.Option[Client] {
+	return func(client *Client) {
+		client.registry = r
+		client.registryTimeout = timeout
+	}
+}
+
+// ClientWithPickerBuilder -> the load balancing strategy when the registry is used,
+// default is round robin
+func ClientWithPickerBuilder(builder balancer.PickerBuilder) option.Option[Client] {
+	return func(client *Client) {
+		client.pickerBuilder = builder
+	}
+}
+
 // NewClient -> create Client
+// address is the address of the server,
+// or the service name if ClientWithRegistry is used.
 func NewClient(address string, opts ...option.Option[Client]) (*Client, error) {
-	poolConfig := &pool.Config{
-		InitialCap: 5,
-		MaxIdle:    20,
-		MaxCap:     30,
-		Factory: func() (interface{}, error) {
-			return net.Dial("tcp", address)
-		},
-		Close: func(i interface{}) error {
-			return i.(net.Conn).Close()
-		},
-		IdleTimeout: time.Minute,
-	}
-	connPool, err := pool.NewChannelPool(poolConfig)
-	if err != nil {
-		return nil, err
-	}
 	client := &Client{
-		connPool:   connPool,
 		serializer: json.Serializer{},
 		// 避免 nil 检测
-		compressor: compress.DoNothingCompressor{},
+		compressor:      compress.DoNothingCompressor{},
+		maxFrameSize:    tcp.DefaultMaxFrameSize,
+		maxConns:        4,
+		registryTimeout: time.Second * 3,
+		pickerBuilder:   &balancer.RoundRobinBuilder{},
+		transport:       transport.TCP{},
 	}
 	for _, opt := range opts {
 		opt(client)
 	}
+	if client.compressThreshold > 0 {
+		client.compressor = thresholdCompressor{Compressor: client.compressor, threshold: client.compressThreshold}
+	}
+	if client.registry == nil {
+		client.connPool = client.newConnPool(address)
+	} else {
+		res, err := newResolver(client.registry, address, client.registryTimeout,
+			client.pickerBuilder, client.newConnPool)
+		if err != nil {
+			return nil, err
+		}
+		client.resolver = res
+	}
+	client.invoker = chainUnaryClientInterceptors(client.interceptors, client.invokeWithRetry)
 	return client, nil
 }
+
+func (c *Client) acceptedCodecs() ([]serialize.Serializer, []compress.Compressor) {
+	return c.acceptedSerializers, c.acceptedCompressors
+}
+
+func (c *Client) newConnPool(address string) *connPool {
+	// the connection is set up in the context of the call which needs it,
+	// it's not bound to the context after the handshake
+	return newConnPool(func(ctx context.Context) (*clientConn, error) {
+		conn, err := c.transport.Dial(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		if c.tlsConfig != nil {
+			tc, er := tlsClient(ctx, conn, address, c.tlsConfig)
+			if er != nil {
+				_ = conn.Close()
+				return nil, er
+			}
+			conn = tc
+		}
+		choice, err := clientHandshake(ctx, conn, c.handshakeOffer(), c.maxFrameSize)
+		if err == nil {
+			err = c.checkChoice(choice)
+		}
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		cc := newClientConn(conn, c.maxFrameSize)
+		if c.heartbeatInterval > 0 {
+			cc.keepalive(c.heartbeatInterval, c.heartbeatTimeout)
+		}
+		return cc, nil
+	}, c.maxConns)
+}
+
+// handshakeOffer -> the client uses only the configured serializer and compressor
+func (c *Client) handshakeOffer() *message2.Handshake {
+	compressors := []uint8{c.compressor.Code()}
+	if _, ok := c.compressor.(thresholdCompressor); ok && c.compressor.Code() != 0 {
+		// the small payloads are not compressed
+		compressors = append(compressors, compress.DoNothingCompressor{}.Code())
+	}
+	return &message2.Handshake{
+		Versions:    supportedVersions,
+		Serializers: []uint8{c.serializer.Code()},
+		Compressors: compressors,
+	}
+}
+
+// checkChoice -> the server may choose a fallback compressor,
+// but the client always compresses the large payloads with the configured one
+func (c *Client) checkChoice(choice *message2.Handshake) error {
+	if len(choice.Serializers) != 1 || choice.Serializers[0] != c.serializer.Code() {
+		return errs.HandshakeFailed(fmt.Sprintf("the server does not support serializer %d", c.serializer.Code()))
+	}
+	if len(choice.Compressors) != 1 || choice.Compressors[0] != c.compressor.Code() {
+		return errs.HandshakeFailed(fmt.Sprintf("the server does not support compressor %d", c.compressor.Code()))
+	}
+	return nil
+}
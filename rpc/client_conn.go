@@ -0,0 +1,370 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"emicro/rpc/compress"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/serialize"
+	"emicro/rpc/tcp"
+	"net"
+	"sync"
+	"time"
+)
+
+// clientConn -> multiplexed client connection
+// Many calls share one connection. Each call waits for the response
+// whose MessageId equals its request's MessageId,
+// and a single reader goroutine dispatches the responses.
+type clientConn struct {
+	conn         net.Conn
+	maxFrameSize uint32
+
+	// serialize writing, one frame must be written completely before the next one
+	writeMutex sync.Mutex
+
+	mutex   sync.Mutex
+	pending map[uint32]pendingCall
+	streams map[uint32]*clientStream
+	// the reason why the connection is closed, nil means it's still alive
+	err  error
+	done chan struct{}
+	// the server is shutting down, no new calls should be sent on this connection
+	goaway bool
+
+	heartbeat heartbeat
+}
+
+func newClientConn(conn net.Conn, maxFrameSize uint32) *clientConn {
+	c := &clientConn{
+		conn:         conn,
+		maxFrameSize: maxFrameSize,
+		pending:      make(map[uint32]pendingCall, 16),
+		streams:      make(map[uint32]*clientStream, 4),
+		done:         make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// pendingCall -> completes the call with its response,
+// or with the error if the connection is closed before the response arrives.
+// It's called exactly once and must not block, because the reader goroutine calls it.
+type pendingCall func(resp *message2.Response, err error)
+
+// call -> send the request and wait for the response with the same MessageId
+func (c *clientConn) call(ctx context.Context, req *message2.Request) (*message2.Response, error) {
+	oneway := isOneway(ctx)
+	type result struct {
+		resp *message2.Response
+		err  error
+	}
+	var ch chan result
+	if !oneway {
+		// register before writing, otherwise the response may arrive before we wait for it
+		ch = make(chan result, 1)
+		if err := c.register(req.MessageId, func(resp *message2.Response, err error) {
+			ch <- result{resp: resp, err: err}
+		}); err != nil {
+			return nil, unsentError{err: err}
+		}
+		defer c.unregister(req.MessageId)
+	}
+	if err := c.write(req); err != nil {
+		return nil, err
+	}
+	if oneway {
+		return nil, errs.OnewayError
+	}
+	select {
+	case <-ctx.Done():
+		c.cancel(req.MessageId)
+		return nil, ctx.Err()
+	case r := <-ch:
+		return r.resp, r.err
+	}
+}
+
+// cancel -> tell the server to cancel the call, so that it stops working on it
+// It doesn't block the caller, the frame is lost if the connection is broken.
+func (c *clientConn) cancel(id uint32) {
+	go func() {
+		req := controlRequest(message2.MessageTypeCancel)
+		req.MessageId = id
+		_ = c.write(req)
+	}()
+}
+
+// start -> send the request of the asynchronous call without waiting,
+// f is completed by the reader goroutine when the response arrives
+func (c *clientConn) start(f *Future, req *message2.Request) {
+	if isOneway(f.ctx) {
+		err := c.write(req)
+		if err == nil {
+			err = errs.OnewayError
+		}
+		f.complete(nil, err)
+		return
+	}
+	if err := c.register(req.MessageId, f.complete); err != nil {
+		f.complete(nil, err)
+		return
+	}
+	if err := c.write(req); err != nil {
+		c.unregister(req.MessageId)
+		f.complete(nil, err)
+		return
+	}
+	// watch ctx after the request is written, so the cancel frame never overtakes it
+	f.setStop(context.AfterFunc(f.ctx, func() {
+		c.unregister(req.MessageId)
+		c.cancel(req.MessageId)
+		f.complete(nil, f.ctx.Err())
+	}))
+}
+
+// newStream -> register the stream and send the open frame
+// onFinish is called exactly once, even if the stream fails to open.
+func (c *clientConn) newStream(ctx context.Context, open *message2.Request,
+	serializer serialize.Serializer, compressor compress.Compressor, onFinish func(err error)) (*clientStream, error) {
+	stream := &clientStream{
+		ctx:        ctx,
+		conn:       c,
+		id:         open.MessageId,
+		open:       open,
+		serializer: serializer,
+		compressor: compressor,
+		buffer:     newStreamBuffer[*message2.Response](streamWindow),
+		window:     newSendWindow(),
+		done:       make(chan struct{}),
+		onFinish:   onFinish,
+	}
+	c.mutex.Lock()
+	var err error
+	if c.err != nil {
+		err = errs.ClientConnClosed(c.err)
+	} else if c.inUse(open.MessageId) {
+		err = errs.DuplicateMessageId(open.MessageId)
+	} else {
+		c.streams[open.MessageId] = stream
+	}
+	c.mutex.Unlock()
+	if err != nil {
+		stream.finish(err)
+		return nil, err
+	}
+
+	if err = c.write(open); err != nil {
+		c.removeStream(open.MessageId)
+		stream.finish(err)
+		return nil, err
+	}
+	go stream.watch()
+	return stream, nil
+}
+
+func (c *clientConn) removeStream(id uint32) {
+	c.mutex.Lock()
+	delete(c.streams, id)
+	c.mutex.Unlock()
+	c.closeIfDrained()
+}
+
+// write -> the header is encoded into a pooled buffer,
+// and it's written with the data of the request without concatenating them
+func (c *clientConn) write(req *message2.Request) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = message2.AppendReqHeader(*buf, req)
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if err := tcp.WriteBuffers(c.conn, *buf, req.Data); err != nil {
+		c.closeWithError(err)
+		return err
+	}
+	return nil
+}
+
+func (c *clientConn) register(id uint32, call pendingCall) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return errs.ClientConnClosed(c.err)
+	}
+	if c.inUse(id) {
+		return errs.DuplicateMessageId(id)
+	}
+	c.pending[id] = call
+	return nil
+}
+
+// inUse -> calls and streams share the same id space, the caller must hold the lock
+func (c *clientConn) inUse(id uint32) bool {
+	_, ok := c.pending[id]
+	if !ok {
+		_, ok = c.streams[id]
+	}
+	return ok
+}
+
+func (c *clientConn) unregister(id uint32) {
+	c.mutex.Lock()
+	delete(c.pending, id)
+	c.mutex.Unlock()
+	c.closeIfDrained()
+}
+
+// goAway -> stop using the connection, and close it after the in-flight calls finish
+func (c *clientConn) goAway() {
+	c.mutex.Lock()
+	c.goaway = true
+	c.mutex.Unlock()
+	c.closeIfDrained()
+}
+
+// closeIfDrained -> close the connection which received GOAWAY and has no in-flight calls
+func (c *clientConn) closeIfDrained() {
+	c.mutex.Lock()
+	drained := c.goaway && len(c.pending) == 0 && len(c.streams) == 0
+	c.mutex.Unlock()
+	if drained {
+		c.closeWithError(errs.ConnGoAwayError)
+	}
+}
+
+// usable -> whether new calls can be sent on the connection
+func (c *clientConn) usable() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err == nil && !c.goaway
+}
+
+// keepalive -> ping the server, close the connection if it's unresponsive
+func (c *clientConn) keepalive(interval, timeout time.Duration) {
+	go c.heartbeat.run(interval, timeout, c.done, func() error {
+		return c.write(controlRequest(message2.MessageTypePing))
+	}, func() {
+		c.closeWithError(errs.HeartbeatTimeoutError)
+	})
+}
+
+// controlRequest -> ping, pong and cancel frames, they don't carry any call
+func controlRequest(typ uint8) *message2.Request {
+	req := &message2.Request{Version: message2.ProtocolVersion, MessageType: typ}
+	req.CalculateHeaderLength()
+	return req
+}
+
+// readLoop -> the only goroutine reading the connection
+func (c *clientConn) readLoop() {
+	for {
+		bs, err := tcp.ReadMsgWithLimit(c.conn, c.maxFrameSize)
+		if err != nil {
+			c.closeWithError(err)
+			return
+		}
+		c.heartbeat.touch()
+		resp, err := message2.DecodeResp(bs)
+		if err != nil {
+			c.closeWithError(err)
+			return
+		}
+		if resp.Version != message2.ProtocolVersion {
+			// the rest of the frame may be misparsed, the connection can not be used anymore
+			c.closeWithError(errs.ProtocolVersionMismatch(message2.ProtocolVersion, resp.Version))
+			return
+		}
+		switch resp.MessageType {
+		case message2.MessageTypeGoAway:
+			c.goAway()
+			continue
+		case message2.MessageTypePing:
+			// don't block reading, the server may be writing to us at the same time
+			go func() {
+				_ = c.write(controlRequest(message2.MessageTypePong))
+			}()
+			continue
+		case message2.MessageTypePong:
+			continue
+		}
+		if message2.IsStream(resp.MessageType) {
+			c.dispatchStream(resp)
+			continue
+		}
+		c.mutex.Lock()
+		call, ok := c.pending[resp.MessageId]
+		delete(c.pending, resp.MessageId)
+		c.mutex.Unlock()
+		// the caller has gone, for example its context is cancelled
+		if !ok {
+			continue
+		}
+		call(resp, nil)
+		// nobody unregisters the asynchronous calls
+		c.closeIfDrained()
+	}
+}
+
+func (c *clientConn) dispatchStream(resp *message2.Response) {
+	c.mutex.Lock()
+	stream, ok := c.streams[resp.MessageId]
+	// half-close and reset from the server both finish the stream
+	finished := ok && resp.MessageType != message2.MessageTypeStreamData &&
+		resp.MessageType != message2.MessageTypeStreamWindowUpdate
+	if finished {
+		delete(c.streams, resp.MessageId)
+	}
+	c.mutex.Unlock()
+	if ok {
+		stream.handle(resp)
+	}
+	if finished {
+		c.closeIfDrained()
+	}
+}
+
+// closed -> whether the connection is no longer usable
+func (c *clientConn) closed() bool {
+	return c.closeErr() != nil
+}
+
+// inflight -> the number of calls waiting for response and open streams
+func (c *clientConn) inflight() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.pending) + len(c.streams)
+}
+
+func (c *clientConn) closeErr() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+func (c *clientConn) closeWithError(err error) {
+	c.mutex.Lock()
+	if c.err != nil {
+		c.mutex.Unlock()
+		return
+	}
+	c.err = err
+	close(c.done)
+	_ = c.conn.Close()
+	for id, stream := range c.streams {
+		stream.finish(errs.ClientConnClosed(err))
+		delete(c.streams, id)
+	}
+	pending := c.pending
+	c.pending = make(map[uint32]pendingCall)
+	c.mutex.Unlock()
+	// the calls may call back into the connection, so they are completed without the lock
+	for _, call := range pending {
+		call(nil, errs.ClientConnClosed(err))
+	}
+}
+
+// Close -> close the connection, calls waiting for response will fail
+func (c *clientConn) Close() error {
+	c.closeWithError(net.ErrClosed)
+	return nil
+}
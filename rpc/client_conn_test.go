@@ -0,0 +1,145 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/tcp"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientConn_call(t *testing.T) {
+	client, server := net.Pipe()
+	cc := newClientConn(client, tcp.DefaultMaxFrameSize)
+	defer func() {
+		_ = cc.Close()
+	}()
+
+	const cnt = 3
+	// the fake server replies in reverse order
+	go func() {
+		reqs := make([]*message2.Request, 0, cnt)
+		for i := 0; i < cnt; i++ {
+			bs, err := tcp.ReadMsg(server)
+			if err != nil {
+				return
+			}
+			req, err := message2.DecodeReq(bs)
+			if err != nil {
+				return
+			}
+			reqs = append(reqs, req)
+		}
+		for i := len(reqs) - 1; i >= 0; i-- {
+			resp := &message2.Response{
+				Version:   message2.ProtocolVersion,
+				MessageId: reqs[i].MessageId,
+				Data:      []byte(reqs[i].MethodName),
+			}
+			resp.CalculateHeaderLength()
+			resp.CalculateBodyLength()
+			_ = tcp.WriteMsg(server, message2.EncodeResp(resp))
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 1; i <= cnt; i++ {
+		wg.Add(1)
+		go func(id uint32) {
+			defer wg.Done()
+			req := &message2.Request{
+				MessageId:   id,
+				ServiceName: "user-service",
+				MethodName:  string(rune('a' + id)),
+			}
+			req.CalculateHeaderLength()
+			req.CalculateBodyLength()
+			resp, err := cc.call(context.Background(), req)
+			require.NoError(t, err)
+			assert.Equal(t, id, resp.MessageId)
+			assert.Equal(t, []byte(req.MethodName), resp.Data)
+		}(uint32(i))
+	}
+	wg.Wait()
+}
+
+func TestClientConn_callClosed(t *testing.T) {
+	client, server := net.Pipe()
+	cc := newClientConn(client, tcp.DefaultMaxFrameSize)
+
+	go func() {
+		_, _ = tcp.ReadMsg(server)
+		// the peer goes away without any response
+		_ = server.Close()
+	}()
+	req := &message2.Request{MessageId: 1, ServiceName: "user-service", MethodName: "GetById"}
+	req.CalculateHeaderLength()
+	_, err := cc.call(context.Background(), req)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.True(t, cc.closed())
+
+	_, err = cc.call(context.Background(), req)
+	assert.Error(t, err)
+}
+
+func TestClientConn_callTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	cc := newClientConn(client, tcp.DefaultMaxFrameSize)
+	defer func() {
+		_ = cc.Close()
+	}()
+	go func() {
+		// read but never reply
+		_, _ = tcp.ReadMsg(server)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	req := &message2.Request{MessageId: 1, ServiceName: "user-service", MethodName: "GetById"}
+	req.CalculateHeaderLength()
+	_, err := cc.call(ctx, req)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 0, cc.inflight())
+}
+
+func TestClientConn_goAway(t *testing.T) {
+	client, server := net.Pipe()
+	cc := newClientConn(client, tcp.DefaultMaxFrameSize)
+	defer func() {
+		_ = cc.Close()
+	}()
+
+	go func() {
+		bs, err := tcp.ReadMsg(server)
+		if err != nil {
+			return
+		}
+		req, err := message2.DecodeReq(bs)
+		if err != nil {
+			return
+		}
+		// the server is shutting down, but the in-flight call is still answered
+		goaway := &message2.Response{Version: message2.ProtocolVersion, MessageType: message2.MessageTypeGoAway}
+		goaway.CalculateHeaderLength()
+		_ = tcp.WriteMsg(server, message2.EncodeResp(goaway))
+		resp := &message2.Response{Version: message2.ProtocolVersion, MessageId: req.MessageId}
+		resp.CalculateHeaderLength()
+		_ = tcp.WriteMsg(server, message2.EncodeResp(resp))
+	}()
+
+	req := &message2.Request{MessageId: 1, ServiceName: "user-service", MethodName: "GetById"}
+	req.CalculateHeaderLength()
+	resp, err := cc.call(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), resp.MessageId)
+	assert.False(t, cc.usable())
+	// closed after the last call finishes
+	assert.Eventually(t, cc.closed, time.Second, time.Millisecond*10)
+	assert.ErrorIs(t, cc.closeErr(), errs.ConnGoAwayError)
+}
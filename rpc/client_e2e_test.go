@@ -2,11 +2,15 @@ package rpc
 
 import (
 	"context"
+	"emicro/internal/errs"
 	"emicro/proto/gen"
+	"emicro/rpc/metadata"
 	"emicro/rpc/serialize/proto"
+	"emicro/rpc/status"
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"sync"
 	"testing"
 	"time"
 )
@@ -20,9 +24,12 @@ func TestInitServiceProto(t *testing.T) {
 		err := server.Start(":8081")
 		t.Log(err)
 	}()
+	defer func() {
+		_ = server.Close()
+	}()
 	time.Sleep(time.Second * 3)
 
-	usClient := &UserService{}
+	usClient := &UserServiceClient{}
 	client, err := NewClient(":8081", ClientWithSerializer(&proto.Serializer{}))
 	require.NoError(t, err)
 	err = client.InitService(usClient)
@@ -38,8 +45,7 @@ func TestInitServiceProto(t *testing.T) {
 		{
 			name: "no error",
 			mock: func() {
-				service.Err = nil
-				service.Msg = "hello, world"
+				service.mock("hello, world", nil)
 			},
 			wantResp: &GetByIdResp{
 				Msg: "hello, world",
@@ -48,23 +54,21 @@ func TestInitServiceProto(t *testing.T) {
 		{
 			name: "error",
 			mock: func() {
-				service.Msg = ""
-				service.Err = errors.New("mock error")
+				service.mock("", errors.New("mock error"))
 			},
 			wantResp: &GetByIdResp{},
-			wantErr:  errors.New("mock error"),
+			wantErr:  status.NewBizError("mock error"),
 		},
 
 		{
 			name: "both",
 			mock: func() {
-				service.Msg = "hello, world"
-				service.Err = errors.New("mock error")
+				service.mock("hello, world", errors.New("mock error"))
 			},
 			wantResp: &GetByIdResp{
 				Msg: "hello, world",
 			},
-			wantErr: errors.New("mock error"),
+			wantErr: status.NewBizError("mock error"),
 		},
 	}
 
@@ -88,9 +92,12 @@ func TestInitClientProxy(t *testing.T) {
 		err := server.Start(":8081")
 		t.Log(err)
 	}()
+	defer func() {
+		_ = server.Close()
+	}()
 	time.Sleep(time.Second * 3)
 
-	usClient := &UserService{}
+	usClient := &UserServiceClient{}
 	//usClientOneway := &UserService{}
 	client, err := NewClient(":8081")
 	require.NoError(t, err)
@@ -111,8 +118,7 @@ func TestInitClientProxy(t *testing.T) {
 		{
 			name: "no error",
 			mock: func() {
-				service.Err = nil
-				service.Msg = "hello, world"
+				service.mock("hello, world", nil)
 			},
 			wantResp: &GetByIdResp{
 				Msg: "hello, world",
@@ -121,23 +127,21 @@ func TestInitClientProxy(t *testing.T) {
 		{
 			name: "error",
 			mock: func() {
-				service.Msg = ""
-				service.Err = errors.New("mock error")
+				service.mock("", errors.New("mock error"))
 			},
 			wantResp: &GetByIdResp{},
-			wantErr:  errors.New("mock error"),
+			wantErr:  status.NewBizError("mock error"),
 		},
 
 		{
 			name: "both",
 			mock: func() {
-				service.Msg = "hello, world"
-				service.Err = errors.New("mock error")
+				service.mock("hello, world", errors.New("mock error"))
 			},
 			wantResp: &GetByIdResp{
 				Msg: "hello, world",
 			},
-			wantErr: errors.New("mock error"),
+			wantErr: status.NewBizError("mock error"),
 		},
 	}
 
@@ -187,9 +191,12 @@ func TestOneway(t *testing.T) {
 		err := server.Start(":8081")
 		t.Log(err)
 	}()
+	defer func() {
+		_ = server.Close()
+	}()
 	time.Sleep(time.Second * 3)
 
-	usClient := &UserService{}
+	usClient := &UserServiceClient{}
 	client, err := NewClient(":8081")
 	require.NoError(t, err)
 	err = client.InitService(usClient)
@@ -204,11 +211,10 @@ func TestOneway(t *testing.T) {
 		{
 			name: "oneway",
 			mock: func() {
-				service.Err = errors.New("mock error")
-				service.Msg = "hello, world"
+				service.mock("hello, world", errors.New("mock error"))
 			},
 			wantResp: &GetByIdResp{},
-			wantErr:  errors.New("micro: 这是一个 oneway 调用，你不应该处理任何结果"),
+			wantErr:  errs.OnewayError,
 		},
 	}
 
@@ -231,30 +237,32 @@ func TestTimeout(t *testing.T) {
 		err := server.Start(":8081")
 		t.Log(err)
 	}()
+	defer func() {
+		_ = server.Close()
+	}()
 	time.Sleep(time.Second * 3)
 
-	usClient := &UserService{}
+	usClient := &UserServiceClient{}
 	client, err := NewClient(":8081")
 	require.NoError(t, err)
 	err = client.InitService(usClient)
 	require.NoError(t, err)
 	testCases := []struct {
 		name     string
-		mock     func() context.Context
+		mock     func() (context.Context, context.CancelFunc)
 		wantErr  error
 		wantResp *GetByIdResp
 	}{
 		{
 			name: "timeout",
-			mock: func() context.Context {
+			mock: func() (context.Context, context.CancelFunc) {
 				service.Err = errors.New("mock error")
 				service.Msg = "hello, world"
 
 				// 服务睡眠 2s
 				// 但是超时设置了一秒，所以客户端预期拿到一个超时响应
 				service.sleep = time.Second * 2
-				ctx, _ := context.WithTimeout(context.Background(), time.Second)
-				return ctx
+				return context.WithTimeout(context.Background(), time.Second)
 			},
 			wantResp: &GetByIdResp{},
 			wantErr:  context.DeadlineExceeded,
@@ -263,9 +271,138 @@ func TestTimeout(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			resp, er := usClient.GetById(tc.mock(), &GetByIdReq{Id: 123})
+			ctx, cancel := tc.mock()
+			defer cancel()
+			resp, er := usClient.GetById(ctx, &GetByIdReq{Id: 123})
 			assert.Equal(t, tc.wantErr, er)
 			assert.Equal(t, tc.wantResp, resp)
 		})
 	}
 }
+
+func TestMultiplexing(t *testing.T) {
+	server := NewServer()
+	service := &UserServiceServerTimeout{t: t, sleep: time.Millisecond * 500, Msg: "hello, world"}
+	_ = server.RegisterService(service)
+	go func() {
+		err := server.Start(":8081")
+		t.Log(err)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	time.Sleep(time.Second * 3)
+
+	usClient := &UserServiceClient{}
+	// all calls share one connection
+	client, err := NewClient(":8081", ClientWithMaxConns(1))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	err = client.InitService(usClient)
+	require.NoError(t, err)
+
+	const cnt = 10
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < cnt; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+			resp, er := usClient.GetById(ctx, &GetByIdReq{Id: 123})
+			assert.NoError(t, er)
+			assert.Equal(t, &GetByIdResp{Msg: "hello, world"}, resp)
+		}()
+	}
+	wg.Wait()
+	// the calls run concurrently on the server, otherwise it takes cnt * 500ms
+	assert.Less(t, time.Since(start), time.Second*2)
+	assert.Len(t, client.connPool.conns, 1)
+}
+
+func TestFrameworkError(t *testing.T) {
+	server := NewServer()
+	_ = server.RegisterService(&UserServiceServer{})
+	go func() {
+		err := server.Start(":8081")
+		t.Log(err)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	time.Sleep(time.Second * 3)
+
+	client, err := NewClient(":8081")
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	usClient := &UnknownServiceClient{}
+	err = client.InitService(usClient)
+	require.NoError(t, err)
+
+	_, err = usClient.GetByName(context.Background(), &GetByIdReq{Id: 123})
+	var se *status.Error
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, status.Unimplemented, se.Code)
+	assert.False(t, status.IsBizError(err))
+}
+
+type UnknownServiceClient struct {
+	GetByName func(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error)
+}
+
+func (s *UnknownServiceClient) Name() string {
+	return "user-service"
+}
+
+// metadataService -> echoes the incoming metadata
+type metadataService struct{}
+
+func (m *metadataService) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, errors.New("no incoming metadata")
+	}
+	if _, ok = md["deadline"]; ok {
+		return nil, errors.New("the framework keys should not be exposed")
+	}
+	return &GetByIdResp{Msg: md.Get("tenant-id") + "," + md.Get("caller")}, nil
+}
+
+func (m *metadataService) Name() string {
+	return "user-service"
+}
+
+func TestMetadata(t *testing.T) {
+	server := NewServer()
+	_ = server.RegisterService(&metadataService{})
+	go func() {
+		err := server.Start(":8093")
+		t.Log(err)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	time.Sleep(time.Second)
+
+	usClient := &UserServiceClient{}
+	client, err := NewClient(":8093")
+	require.NoError(t, err)
+	require.NoError(t, client.InitService(usClient))
+
+	ctx := metadata.NewOutgoingContext(context.Background(),
+		metadata.Pairs("tenant-id", "42", "caller", "order-service"))
+	ctx, cancel := context.WithTimeout(ctx, time.Second*3)
+	defer cancel()
+	resp, err := usClient.GetById(ctx, &GetByIdReq{Id: 123})
+	require.NoError(t, err)
+	assert.Equal(t, "42,order-service", resp.Msg)
+
+	resp, err = usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+	require.NoError(t, err)
+	assert.Equal(t, ",", resp.Msg)
+}
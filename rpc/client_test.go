@@ -1,15 +1,24 @@
 package rpc
 
 import (
+	"bytes"
 	"context"
+	"emicro/internal/errs"
 	"emicro/proto/gen"
+	"emicro/rpc/compress"
 	"emicro/rpc/compress/gzip"
 	message2 "emicro/rpc/message"
+	"emicro/rpc/metadata"
 	"emicro/rpc/serialize/json"
-	"errors"
+	"emicro/rpc/status"
+	"fmt"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"log"
+	"reflect"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
@@ -29,46 +38,74 @@ func Test_setFuncField(t *testing.T) {
 			mock: func(ctrl *gomock.Controller) Proxy {
 				return NewMockProxy(ctrl)
 			},
-			wantErr: errors.New("rpc: 不支持 nil"),
+			wantErr: errs.ServiceNilError,
 		},
 		{
 			name:    "no pointer",
-			service: &UserServiceClient{},
+			service: noPointerService{},
 			mock: func(ctrl *gomock.Controller) Proxy {
 				return NewMockProxy(ctrl)
 			},
-			wantErr: errors.New("rpc: 只支持指向结构体的一级指针"),
+			wantErr: errs.ServiceTypError,
 		},
 		{
 			name: "user service",
 			mock: func(ctrl *gomock.Controller) Proxy {
 				p := NewMockProxy(ctrl)
-				p.EXPECT().Invoke(gomock.Any(), &message2.Request{
+				p.EXPECT().Invoke(gomock.Any(), requestMatcher{
 					ServiceName: "user-service",
 					MethodName:  "GetById",
 					Data:        []byte(`{"Id":123}`),
 				}).Return(&message2.Response{}, nil)
 				return p
 			},
-			service: &UserService{},
+			service: &UserServiceClient{},
 		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
-			err := setFuncField(json.Serializer{}, gzip.Compressor{}, tc.service, tc.mock(ctrl))
+			err := setFuncField(json.Serializer{}, compress.DoNothingCompressor{}, tc.service, tc.mock(ctrl))
 			assert.Equal(t, tc.wantErr, err)
 			if err != nil {
 				return
 			}
-			resp, err := tc.service.(*UserService).GetById(context.Background(), &GetByIdReq{Id: 123})
+			resp, err := tc.service.(*UserServiceClient).GetById(context.Background(), &GetByIdReq{Id: 123})
 			assert.Equal(t, tc.wantErr, err)
 			t.Log(resp)
 		})
 	}
 }
 
+// requestMatcher only compares the fields that the caller decides,
+// the others such as MessageId and lengths are filled in by the framework
+type requestMatcher struct {
+	ServiceName string
+	MethodName  string
+	Data        []byte
+}
+
+func (r requestMatcher) Matches(x interface{}) bool {
+	req, ok := x.(*message2.Request)
+	if !ok {
+		return false
+	}
+	return req.ServiceName == r.ServiceName &&
+		req.MethodName == r.MethodName &&
+		bytes.Equal(req.Data, r.Data)
+}
+
+func (r requestMatcher) String() string {
+	return fmt.Sprintf("service %s, method %s, data %s", r.ServiceName, r.MethodName, r.Data)
+}
+
+type noPointerService struct{}
+
+func (n noPointerService) Name() string {
+	return "no-pointer"
+}
+
 type UserServiceClient struct {
 	// 用反射来赋值
 	// 类型是函数的字段，它不是方法（它不是定义在 UserService 上的方法）
@@ -91,24 +128,41 @@ type GetByIdResp struct {
 }
 
 type UserServiceServer struct {
-	Err error
-	Msg string
+	// the tests change the response between the calls, which are handled in other goroutines
+	mutex sync.RWMutex
+	Err   error
+	Msg   string
+}
+
+// mock -> set the response of the following calls
+func (u *UserServiceServer) mock(msg string, err error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.Msg, u.Err = msg, err
+}
+
+func (u *UserServiceServer) response() (string, error) {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	return u.Msg, u.Err
 }
 
 func (u *UserServiceServer) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
 	log.Println(req)
+	msg, err := u.response()
 	return &GetByIdResp{
-		Msg: u.Msg,
-	}, u.Err
+		Msg: msg,
+	}, err
 }
 
 func (u *UserServiceServer) GetByIdProto(ctx context.Context, req *gen.GetByIdReq) (*gen.GetByIdResp, error) {
 	log.Println(req)
+	msg, err := u.response()
 	return &gen.GetByIdResp{
 		User: &gen.User{
-			Name: u.Msg,
+			Name: msg,
 		},
-	}, u.Err
+	}, err
 }
 
 func (u *UserServiceServer) Name() string {
@@ -135,3 +189,142 @@ func (u *UserServiceServerTimeout) GetById(ctx context.Context, req *GetByIdReq)
 func (u *UserServiceServerTimeout) Name() string {
 	return "user-service"
 }
+
+type proxyFunc func(ctx context.Context, request *message2.Request) (*message2.Response, error)
+
+func (p proxyFunc) Invoke(ctx context.Context, request *message2.Request) (*message2.Response, error) {
+	return p(ctx, request)
+}
+
+func Test_callCompressThreshold(t *testing.T) {
+	testCases := []struct {
+		name string
+		in   any
+
+		wantCode byte
+	}{
+		{
+			name:     "small",
+			in:       &GetByIdReq{Id: 123},
+			wantCode: compress.DoNothingCompressor{}.Code(),
+		},
+		{
+			name:     "large",
+			in:       &GetByIdResp{Msg: string(bytes.Repeat([]byte("hello"), 100))},
+			wantCode: gzip.Compressor{}.Code(),
+		},
+	}
+	compressor := thresholdCompressor{Compressor: gzip.Compressor{}, threshold: 64}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// the fake server echoes the request with the same compressor
+			proxy := proxyFunc(func(ctx context.Context, req *message2.Request) (*message2.Response, error) {
+				assert.Equal(t, tc.wantCode, req.Compresser)
+				return &message2.Response{Compresser: req.Compresser, Data: req.Data}, nil
+			})
+			out := reflect.New(reflect.TypeOf(tc.in).Elem()).Interface()
+			err := call(context.Background(), json.Serializer{}, compressor, proxy,
+				"user-service", "GetById", tc.in, out)
+			require.NoError(t, err)
+			assert.Equal(t, tc.in, out)
+		})
+	}
+}
+
+func Test_newRequestMetadata(t *testing.T) {
+	testCases := []struct {
+		name string
+		ctx  func() context.Context
+
+		wantMeta map[string]string
+		wantErr  error
+	}{
+		{
+			name: "no metadata",
+			ctx: func() context.Context {
+				return context.Background()
+			},
+			wantMeta: map[string]string{},
+		},
+		{
+			name: "outgoing metadata",
+			ctx: func() context.Context {
+				ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("Tenant-Id", "1"))
+				ctx = metadata.AppendToOutgoingContext(ctx, "caller", "order-service")
+				return CtxWithOneway(ctx)
+			},
+			wantMeta: map[string]string{"tenant-id": "1", "caller": "order-service", "one-way": "true"},
+		},
+		{
+			name: "invalid metadata",
+			ctx: func() context.Context {
+				return metadata.AppendToOutgoingContext(context.Background(), "trace-id", "a\nb")
+			},
+			wantErr: errs.InvalidMetadata("trace-id", "a\nb"),
+		},
+		{
+			name: "reserved key",
+			ctx: func() context.Context {
+				return metadata.AppendToOutgoingContext(context.Background(), "deadline", "0")
+			},
+			wantErr: errs.ReservedMetadata("deadline"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := newRequest(tc.ctx(), json.Serializer{}, compress.DoNothingCompressor{},
+				"user-service", "GetById", nil)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantMeta, req.Meta)
+			if len(tc.wantMeta) > 0 {
+				// the metadata survives the encoding
+				decoded, err := message2.DecodeReq(message2.EncodeReq(req))
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantMeta, decoded.Meta)
+			}
+		})
+	}
+}
+
+func TestClient_RequestLimits(t *testing.T) {
+	server := NewServer()
+	require.NoError(t, server.RegisterService(&echoService{}))
+	go func() {
+		err := server.Start(":8098")
+		t.Log(err)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	time.Sleep(time.Second)
+	client, err := NewClient(":8098", ClientWithMaxConns(1))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+
+	// an in-flight call on the same connection
+	inflight := &GetByIdResp{}
+	f := client.CallAsync(context.Background(), "user-service", "GetById", &GetByIdReq{Id: 200}, inflight)
+
+	pairs := make([]string, 0, 400)
+	for i := 0; i < 200; i++ {
+		pairs = append(pairs, "key-"+strconv.Itoa(i), "v")
+	}
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs(pairs...))
+	err = client.Call(ctx, "user-service", "GetById", &GetByIdReq{Id: 1}, &GetByIdResp{})
+	se, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.InvalidArgument, se.Code)
+
+	// only the oversized call fails
+	require.NoError(t, f.Wait())
+	assert.Equal(t, "200", inflight.Msg)
+	_, err = server.InvokeJSON(ctx, "user-service", "GetById", []byte(`{"Id":1}`))
+	se, ok = status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.InvalidArgument, se.Code)
+}
@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"emicro/internal/errs"
+	"emicro/rpc/compress"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/serialize"
+	"emicro/rpc/status"
+	"strconv"
+	"strings"
+)
+
+// codecAcceptor -> the proxy accepting the responses encoded by other codecs than the ones of the request,
+// Client implements it, see ClientWithAcceptedSerializers and ClientWithAcceptedCompressors
+type codecAcceptor interface {
+	acceptedCodecs() ([]serialize.Serializer, []compress.Compressor)
+}
+
+// acceptCodecs -> advertise the codecs accepted by the proxy in the request, and return them
+func acceptCodecs(proxy any, req *message2.Request,
+	serializer serialize.Serializer) ([]serialize.Serializer, []compress.Compressor) {
+	acceptor, ok := proxy.(codecAcceptor)
+	if !ok {
+		return nil, nil
+	}
+	serializers, compressors := acceptor.acceptedCodecs()
+	if _, ok = serializer.(rawSerializer); ok {
+		// the raw data must be returned in the format the caller asked for
+		serializers = nil
+	}
+	setAccept(req, serializers, compressors)
+	return serializers, compressors
+}
+
+// setAccept -> advertise the accepted codecs in the request
+func setAccept(req *message2.Request, serializers []serialize.Serializer, compressors []compress.Compressor) {
+	if len(serializers) == 0 && len(compressors) == 0 {
+		return
+	}
+	if len(serializers) > 0 {
+		req.Meta[metaAcceptSerializers] = joinCodes(serializers)
+	}
+	if len(compressors) > 0 {
+		req.Meta[metaAcceptCompressors] = joinCodes(compressors)
+	}
+	req.CalculateHeaderLength()
+}
+
+func joinCodes[T interface{ Code() byte }](codecs []T) string {
+	var sb strings.Builder
+	for i, c := range codecs {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.Itoa(int(c.Code())))
+	}
+	return sb.String()
+}
+
+// responseCodecs -> the codecs the response is encoded by,
+// they are the ones of the request unless the server chooses the accepted ones
+func responseCodecs(resp *message2.Response, serializer serialize.Serializer, compressor compress.Compressor,
+	serializers []serialize.Serializer, compressors []compress.Compressor) (serialize.Serializer, compress.Compressor, error) {
+	s, ok := findCodec(resp.Serializer, serializer, serializers)
+	if !ok {
+		return nil, nil, errs.UnsupportedCodec(resp.Serializer, resp.Compresser)
+	}
+	c, ok := findCodec(resp.Compresser, compressor, compressors)
+	if !ok {
+		return nil, nil, errs.UnsupportedCodec(resp.Serializer, resp.Compresser)
+	}
+	return s, c, nil
+}
+
+// findCodec -> the codec of code, first is used without checking the code if nothing else is accepted
+func findCodec[T interface{ Code() byte }](code uint8, first T, others []T) (T, bool) {
+	if len(others) == 0 || first.Code() == code {
+		return first, true
+	}
+	for _, c := range others {
+		if c.Code() == code {
+			return c, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// serverCodecs -> the codecs of a call on the server
+type serverCodecs struct {
+	reqSerializer  serialize.Serializer
+	reqCompressor  compress.Compressor
+	respSerializer serialize.Serializer
+	respCompressor compress.Compressor
+}
+
+// negotiate -> the request is decoded by its own codecs, which must be registered.
+// The response is encoded by the first codecs accepted by the client and registered on the server,
+// or by the codecs of the request. The codes of resp are set to the chosen ones.
+func negotiate(req *message2.Request, resp *message2.Response,
+	serializers []serialize.Serializer, compressors []compress.Compressor) (serverCodecs, error) {
+	c := serverCodecs{
+		reqSerializer: serializers[req.Serializer],
+		reqCompressor: compressors[req.Compresser],
+	}
+	c.respSerializer = firstAccepted(req.Meta[metaAcceptSerializers], serializers, c.reqSerializer)
+	c.respCompressor = firstAccepted(req.Meta[metaAcceptCompressors], compressors, c.reqCompressor)
+	if c.respSerializer != nil {
+		resp.Serializer = c.respSerializer.Code()
+	}
+	if c.respCompressor != nil {
+		resp.Compresser = c.respCompressor.Code()
+	}
+	if c.reqSerializer == nil || c.reqCompressor == nil {
+		return c, status.New(status.Unimplemented, errs.UnsupportedCodec(req.Serializer, req.Compresser).Error())
+	}
+	return c, nil
+}
+
+// firstAccepted -> the first registered codec in accept, a list of codes like "2,1", or def if there is none
+func firstAccepted[T interface{ Code() byte }](accept string, registered []T, def T) T {
+	for accept != "" {
+		var code string
+		code, accept, _ = strings.Cut(accept, ",")
+		n, err := strconv.ParseUint(code, 10, 8)
+		if err != nil {
+			continue
+		}
+		if c := registered[n]; any(c) != nil {
+			return c
+		}
+	}
+	return def
+}
@@ -0,0 +1,197 @@
+package rpc
+
+import (
+	"context"
+	"emicro/rpc/compress"
+	"emicro/rpc/compress/gzip"
+	"emicro/rpc/compress/snappy"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/serialize"
+	"emicro/rpc/serialize/json"
+	"emicro/rpc/serialize/proto"
+	"emicro/rpc/status"
+	"emicro/rpc/transport"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecNegotiation(t *testing.T) {
+	mem := transport.NewMemory(0)
+	server := NewServer(ServerWithTransport(mem))
+	server.RegisterCompressor(gzip.Compressor{})
+	require.NoError(t, server.RegisterService(&echoService{}))
+	listener, err := mem.Listen("user-service")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+
+	// record the codes of the last call
+	var reqCompressor, respCompressor uint8
+	record := func(ctx context.Context, req *message2.Request, invoker UnaryInvoker) (*message2.Response, error) {
+		reqCompressor = req.Compresser
+		resp, err := invoker(ctx, req)
+		if resp != nil {
+			respCompressor = resp.Compresser
+		}
+		return resp, err
+	}
+
+	testCases := []struct {
+		name   string
+		ctx    context.Context
+		accept []compress.Compressor
+
+		wantReqCompressor  uint8
+		wantRespCompressor uint8
+		wantResp           *GetByIdResp
+		wantErr            error
+	}{
+		{
+			name:               "default",
+			ctx:                context.Background(),
+			wantReqCompressor:  compress.DoNothingCompressor{}.Code(),
+			wantRespCompressor: compress.DoNothingCompressor{}.Code(),
+			wantResp:           &GetByIdResp{Msg: "1"},
+		},
+		{
+			name:               "compressor in ctx",
+			ctx:                CtxWithCompressor(context.Background(), gzip.Compressor{}),
+			wantReqCompressor:  gzip.Compressor{}.Code(),
+			wantRespCompressor: gzip.Compressor{}.Code(),
+			wantResp:           &GetByIdResp{Msg: "1"},
+		},
+		{
+			name:               "accepted compressor",
+			ctx:                context.Background(),
+			accept:             []compress.Compressor{gzip.Compressor{}},
+			wantReqCompressor:  compress.DoNothingCompressor{}.Code(),
+			wantRespCompressor: gzip.Compressor{}.Code(),
+			wantResp:           &GetByIdResp{Msg: "1"},
+		},
+		{
+			name:               "accepted compressor not registered",
+			ctx:                context.Background(),
+			accept:             []compress.Compressor{snappy.Compressor{}, gzip.Compressor{}},
+			wantReqCompressor:  compress.DoNothingCompressor{}.Code(),
+			wantRespCompressor: gzip.Compressor{}.Code(),
+			wantResp:           &GetByIdResp{Msg: "1"},
+		},
+		{
+			name:               "request compressor not registered",
+			ctx:                CtxWithCompressor(context.Background(), snappy.Compressor{}),
+			wantReqCompressor:  snappy.Compressor{}.Code(),
+			wantRespCompressor: snappy.Compressor{}.Code(),
+			wantResp:           &GetByIdResp{},
+			wantErr:            status.New(status.Unimplemented, "emicro: unsupported serializer 1 or compressor 2"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewClient("user-service", ClientWithTransport(mem),
+				ClientWithInterceptors(record), ClientWithAcceptedCompressors(tc.accept...))
+			require.NoError(t, err)
+			defer func() {
+				_ = client.Close()
+			}()
+			usClient := &UserServiceClient{}
+			require.NoError(t, client.InitService(usClient))
+
+			resp, err := usClient.GetById(tc.ctx, &GetByIdReq{Id: 1})
+			assertStatus(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantResp, resp)
+			assert.Equal(t, tc.wantReqCompressor, reqCompressor)
+			assert.Equal(t, tc.wantRespCompressor, respCompressor)
+
+			// the asynchronous calls negotiate in the same way
+			resp = &GetByIdResp{}
+			err = client.CallAsync(tc.ctx, "user-service", "GetById", &GetByIdReq{Id: 1}, resp).Wait()
+			assertStatus(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantResp, resp)
+			assert.Equal(t, tc.wantRespCompressor, respCompressor)
+		})
+	}
+}
+
+func assertStatus(t *testing.T, want, err error) {
+	if want == nil {
+		assert.NoError(t, err)
+		return
+	}
+	var se *status.Error
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, want.Error(), se.Error())
+}
+
+func TestNegotiate(t *testing.T) {
+	serializers := make([]serialize.Serializer, 256)
+	serializers[json.Serializer{}.Code()] = json.Serializer{}
+	serializers[proto.Serializer{}.Code()] = proto.Serializer{}
+	compressors := make([]compress.Compressor, 256)
+	compressors[compress.DoNothingCompressor{}.Code()] = compress.DoNothingCompressor{}
+	compressors[gzip.Compressor{}.Code()] = gzip.Compressor{}
+
+	testCases := []struct {
+		name string
+		req  *message2.Request
+
+		wantRespSerializer uint8
+		wantRespCompressor uint8
+		wantErr            bool
+	}{
+		{
+			name:               "codecs of the request",
+			req:                &message2.Request{Serializer: 1, Compresser: 0, Meta: map[string]string{}},
+			wantRespSerializer: 1,
+			wantRespCompressor: 0,
+		},
+		{
+			name: "accepted codecs",
+			req: &message2.Request{Serializer: 1, Compresser: 0, Meta: map[string]string{
+				metaAcceptSerializers: "2",
+				metaAcceptCompressors: "1",
+			}},
+			wantRespSerializer: 2,
+			wantRespCompressor: 1,
+		},
+		{
+			name: "the first registered one",
+			req: &message2.Request{Serializer: 1, Compresser: 0, Meta: map[string]string{
+				metaAcceptSerializers: "9,x,2,1",
+				metaAcceptCompressors: "2,1",
+			}},
+			wantRespSerializer: 2,
+			wantRespCompressor: 1,
+		},
+		{
+			name: "request serializer not registered",
+			req: &message2.Request{Serializer: 9, Compresser: 0, Meta: map[string]string{
+				metaAcceptSerializers: "1",
+			}},
+			wantRespSerializer: 1,
+			wantRespCompressor: 0,
+			wantErr:            true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &message2.Response{Serializer: tc.req.Serializer, Compresser: tc.req.Compresser}
+			codecs, err := negotiate(tc.req, resp, serializers, compressors)
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.wantRespSerializer, resp.Serializer)
+			assert.Equal(t, tc.wantRespCompressor, resp.Compresser)
+			if err == nil {
+				assert.Equal(t, tc.req.Serializer, codecs.reqSerializer.Code())
+				assert.Equal(t, tc.wantRespSerializer, codecs.respSerializer.Code())
+			}
+		})
+	}
+}
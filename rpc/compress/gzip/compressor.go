@@ -3,51 +3,79 @@ package gzip
 import (
 	"bytes"
 	"compress/gzip"
+	"emicro/internal/errs"
 	"emicro/rpc/compress"
 	"io"
-	"io/ioutil"
+	"sync"
 )
 
 var _ compress.Compressor = Compressor{}
 
+var (
+	// writers -> gzip writers of the default level, creating one allocates hundreds of KB
+	writers = sync.Pool{
+		New: func() any {
+			return gzip.NewWriter(nil)
+		},
+	}
+	readers sync.Pool
+)
+
 // Compressor implements the Compressor interface
+// The writers and readers are pooled, so it's cheap to compress small payloads.
 type Compressor struct{}
 
 func (_ Compressor) Compress(data []byte) ([]byte, error) {
-	// res := &bytes.Buffer{}
-	res := bytes.NewBuffer(nil)
-	w := gzip.NewWriter(res)
-	_, err := w.Write(data)
-	if err != nil {
-		return nil, err
-	}
-	err = w.Flush()
-	if err != nil {
+	w := writers.Get().(*gzip.Writer)
+	defer writers.Put(w)
+	return compressWith(w, data)
+}
+
+// compressWith -> w is reset to write into a new buffer
+func compressWith(w *gzip.Writer, data []byte) ([]byte, error) {
+	// the gzip header and footer are 18 bytes, and the small payloads may not shrink
+	res := bytes.NewBuffer(make([]byte, 0, len(data)/2+64))
+	w.Reset(res)
+	if _, err := w.Write(data); err != nil {
 		return nil, err
 	}
 	// Defer cannot be used here. You must call Close manually
 	// Otherwise, some data has not been refreshed to res,
 	// execute Uncompress return []byte{}
 	// This is a very error prone place
-	if err = w.Close(); err != nil {
+	if err := w.Close(); err != nil {
 		return nil, err
 	}
 	return res.Bytes(), nil
 }
 
 func (_ Compressor) UnCompress(data []byte) ([]byte, error) {
-	r, err := gzip.NewReader(bytes.NewReader(data))
-	if err != nil {
-		return nil, err
+	var r *gzip.Reader
+	if pooled, ok := readers.Get().(*gzip.Reader); ok {
+		r = pooled
+		if err := r.Reset(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if r, err = gzip.NewReader(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
 	}
 	defer func() {
 		_ = r.Close()
+		readers.Put(r)
 	}()
-	res, err := ioutil.ReadAll(r)
+	// the compressed data is usually smaller than the original one
+	res := bytes.NewBuffer(make([]byte, 0, len(data)*2+64))
+	_, err := res.ReadFrom(io.LimitReader(r, compress.MaxDecodedSize+1))
+	if res.Len() > compress.MaxDecodedSize {
+		return nil, errs.DecompressTooLarge(compress.MaxDecodedSize)
+	}
 	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		return nil, err
 	}
-	return res, nil
+	return res.Bytes(), nil
 }
 
 func (_ Compressor) Code() byte {
@@ -1,6 +1,9 @@
 package gzip
 
 import (
+	"bytes"
+	"emicro/internal/errs"
+	"emicro/rpc/compress"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -27,3 +30,50 @@ func TestCompressor(t *testing.T) {
 		})
 	}
 }
+
+func TestCompressor_UnCompressTooLarge(t *testing.T) {
+	c := Compressor{}
+	data, err := c.Compress(make([]byte, compress.MaxDecodedSize))
+	require.NoError(t, err)
+	res, err := c.UnCompress(data)
+	require.NoError(t, err)
+	assert.Equal(t, compress.MaxDecodedSize, len(res))
+
+	data, err = c.Compress(make([]byte, compress.MaxDecodedSize+1))
+	require.NoError(t, err)
+	_, err = c.UnCompress(data)
+	assert.ErrorIs(t, err, errs.DecompressTooLargeError)
+}
+
+func TestCompressor_reuse(t *testing.T) {
+	c := Compressor{}
+	// the pooled writers and readers must be reset between the calls
+	for _, input := range [][]byte{[]byte("hello world"), {}, []byte("hello emicro")} {
+		data, err := c.Compress(input)
+		require.NoError(t, err)
+		data, err = c.UnCompress(data)
+		require.NoError(t, err)
+		assert.Equal(t, string(input), string(data))
+	}
+	_, err := c.UnCompress([]byte("not gzip"))
+	assert.Error(t, err)
+}
+
+func BenchmarkCompressor_Compress(b *testing.B) {
+	c := Compressor{}
+	data := bytes.Repeat([]byte("hello world"), 100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = c.Compress(data)
+	}
+}
+
+func BenchmarkCompressor_UnCompress(b *testing.B) {
+	c := Compressor{}
+	data, err := c.Compress(bytes.Repeat([]byte("hello world"), 100))
+	require.NoError(b, err)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = c.UnCompress(data)
+	}
+}
@@ -0,0 +1,38 @@
+package gzip
+
+import (
+	"compress/gzip"
+	"emicro/rpc/compress"
+	"sync"
+)
+
+var _ compress.Compressor = (*LevelCompressor)(nil)
+
+// LevelCompressor -> gzip with a configurable level, the writers are pooled
+// The data is compatible with Compressor, so they share the same code.
+type LevelCompressor struct {
+	Compressor
+	level   int
+	writers sync.Pool
+}
+
+// NewLevelCompressor -> level is one of gzip.HuffmanOnly, gzip.DefaultCompression,
+// or from gzip.BestSpeed to gzip.BestCompression
+func NewLevelCompressor(level int) (*LevelCompressor, error) {
+	// verify the level, NewWriterLevel fails only if the level is invalid
+	if _, err := gzip.NewWriterLevel(nil, level); err != nil {
+		return nil, err
+	}
+	c := &LevelCompressor{level: level}
+	c.writers.New = func() any {
+		w, _ := gzip.NewWriterLevel(nil, c.level)
+		return w
+	}
+	return c, nil
+}
+
+func (c *LevelCompressor) Compress(data []byte) ([]byte, error) {
+	w := c.writers.Get().(*gzip.Writer)
+	defer c.writers.Put(w)
+	return compressWith(w, data)
+}
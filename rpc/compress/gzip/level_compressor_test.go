@@ -0,0 +1,59 @@
+package gzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func TestLevelCompressor(t *testing.T) {
+	testCases := []struct {
+		name    string
+		level   int
+		wantErr bool
+	}{
+		{
+			name:  "best speed",
+			level: gzip.BestSpeed,
+		},
+		{
+			name:  "best compression",
+			level: gzip.BestCompression,
+		},
+		{
+			name:    "invalid level",
+			level:   10,
+			wantErr: true,
+		},
+	}
+	input := bytes.Repeat([]byte("hello world"), 1000)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewLevelCompressor(tc.level)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			// the pooled writers are used concurrently
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					data, er := c.Compress(input)
+					require.NoError(t, er)
+					// compatible with Compressor
+					data, er = Compressor{}.UnCompress(data)
+					require.NoError(t, er)
+					assert.Equal(t, input, data)
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, Compressor{}.Code(), c.Code())
+		})
+	}
+}
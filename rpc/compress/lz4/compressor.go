@@ -0,0 +1,43 @@
+package lz4
+
+import (
+	"bytes"
+	"emicro/rpc/compress"
+	"github.com/pierrec/lz4/v4"
+	"sync"
+)
+
+var _ compress.Compressor = Compressor{}
+
+// writers -> lz4.Writer allocates large buffers, so reuse them
+var writers = sync.Pool{
+	New: func() any {
+		return lz4.NewWriter(nil)
+	},
+}
+
+// Compressor implements the Compressor interface with the lz4 frame format
+type Compressor struct{}
+
+func (_ Compressor) Compress(data []byte) ([]byte, error) {
+	res := bytes.NewBuffer(make([]byte, 0, lz4.CompressBlockBound(len(data))))
+	w := writers.Get().(*lz4.Writer)
+	defer writers.Put(w)
+	w.Reset(res)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	// Close flushes the data and writes the end mark of the frame
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return res.Bytes(), nil
+}
+
+func (_ Compressor) UnCompress(data []byte) ([]byte, error) {
+	return compress.ReadAll(lz4.NewReader(bytes.NewReader(data)))
+}
+
+func (_ Compressor) Code() byte {
+	return 3
+}
@@ -0,0 +1,33 @@
+package snappy
+
+import (
+	"emicro/internal/errs"
+	"emicro/rpc/compress"
+	"github.com/golang/snappy"
+)
+
+var _ compress.Compressor = Compressor{}
+
+// Compressor implements the Compressor interface with the snappy block format
+// It's much faster than gzip, but the compression ratio is lower.
+type Compressor struct{}
+
+func (_ Compressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (_ Compressor) UnCompress(data []byte) ([]byte, error) {
+	// the decoded length is in the header, check it before allocating the buffer
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if n > compress.MaxDecodedSize {
+		return nil, errs.DecompressTooLarge(compress.MaxDecodedSize)
+	}
+	return snappy.Decode(nil, data)
+}
+
+func (_ Compressor) Code() byte {
+	return 2
+}
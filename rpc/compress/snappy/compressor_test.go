@@ -0,0 +1,60 @@
+package snappy
+
+import (
+	"bytes"
+	"emicro/internal/errs"
+	"emicro/rpc/compress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCompressor(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input []byte
+	}{
+		{
+			name:  "hello world",
+			input: []byte("hello world"),
+		},
+		{
+			name:  "empty",
+			input: []byte{},
+		},
+		{
+			name:  "large",
+			input: bytes.Repeat([]byte("hello world"), 10000),
+		},
+	}
+	c := Compressor{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := c.Compress(tc.input)
+			require.NoError(t, err)
+			data, err = c.UnCompress(data)
+			require.NoError(t, err)
+			assert.Equal(t, len(tc.input), len(data))
+			assert.True(t, bytes.Equal(tc.input, data))
+		})
+	}
+}
+
+func TestCompressor_UnCompressInvalid(t *testing.T) {
+	_, err := Compressor{}.UnCompress([]byte("hello world"))
+	assert.Error(t, err)
+}
+
+func TestCompressor_UnCompressTooLarge(t *testing.T) {
+	c := Compressor{}
+	data, err := c.Compress(make([]byte, compress.MaxDecodedSize))
+	require.NoError(t, err)
+	res, err := c.UnCompress(data)
+	require.NoError(t, err)
+	assert.Equal(t, compress.MaxDecodedSize, len(res))
+
+	data, err = c.Compress(make([]byte, compress.MaxDecodedSize+1))
+	require.NoError(t, err)
+	_, err = c.UnCompress(data)
+	assert.ErrorIs(t, err, errs.DecompressTooLargeError)
+}
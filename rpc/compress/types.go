@@ -1,5 +1,14 @@
 package compress
 
+import (
+	"emicro/internal/errs"
+	"io"
+)
+
+// MaxDecodedSize -> the maximum size of the uncompressed data,
+// so that a small frame can not expand into a huge buffer
+const MaxDecodedSize = 64 << 20
+
 type Compressor interface {
 	Code() byte
 	Compress(data []byte) ([]byte, error)
@@ -19,3 +28,13 @@ func (d DoNothingCompressor) Compress(data []byte) ([]byte, error) {
 func (d DoNothingCompressor) UnCompress(data []byte) ([]byte, error) {
 	return data, nil
 }
+
+// ReadAll -> read the uncompressed data from r, at most MaxDecodedSize bytes
+// The data read before the error is returned along with it, unless the limit is exceeded.
+func ReadAll(r io.Reader) ([]byte, error) {
+	res, err := io.ReadAll(io.LimitReader(r, MaxDecodedSize+1))
+	if len(res) > MaxDecodedSize {
+		return nil, errs.DecompressTooLarge(MaxDecodedSize)
+	}
+	return res, err
+}
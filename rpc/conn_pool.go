@@ -0,0 +1,143 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"sync"
+)
+
+// connPool -> multiplexed connections to the same address
+// Because every connection can carry many in-flight calls,
+// a new connection is created only when all existing connections are busy.
+type connPool struct {
+	mutex    sync.Mutex
+	factory  func(ctx context.Context) (*clientConn, error)
+	maxConns int
+	conns    []*clientConn
+	closed   bool
+	// the connections being dialed, they take their slots before the dialing finishes
+	dialing int
+	// closed and replaced when a dialing finishes, so that the callers waiting for a slot can retry
+	dialed chan struct{}
+}
+
+func newConnPool(factory func(ctx context.Context) (*clientConn, error), maxConns int) *connPool {
+	return &connPool{
+		factory:  factory,
+		maxConns: maxConns,
+		conns:    make([]*clientConn, 0, maxConns),
+		dialed:   make(chan struct{}),
+	}
+}
+
+// Get -> pick the least loaded connection, dial a new one if necessary
+// The dialing runs without holding the lock, so a slow dial doesn't block the callers
+// which can use the existing connections. Dialing and waiting for a slot are bounded by ctx.
+func (p *connPool) Get(ctx context.Context) (*clientConn, error) {
+	for {
+		conn, dialed, err := p.pick()
+		if err != nil || conn != nil {
+			return conn, err
+		}
+		if dialed == nil {
+			return p.dial(ctx)
+		}
+		// all slots are being dialed, wait for one of them
+		select {
+		case <-dialed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// pick -> return the connection to use, or the channel to wait on if all slots are being dialed,
+// or nothing if the caller should dial a new connection, whose slot is reserved already
+func (p *connPool) pick() (*clientConn, <-chan struct{}, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return nil, nil, errs.ClientClosedError
+	}
+	// remove the dead connections and the ones received GOAWAY,
+	// the latter are closed by themselves after their in-flight calls finish.
+	// Connections whose heartbeat timed out are closed as soon as it's detected,
+	// so they are removed here before any call is sent on them.
+	alive := p.conns[:0]
+	for _, c := range p.conns {
+		if c.usable() {
+			alive = append(alive, c)
+		}
+	}
+	p.conns = alive
+
+	chosen, chosenInflight := p.leastLoaded()
+	full := len(p.conns)+p.dialing >= p.maxConns
+	if chosen != nil && (chosenInflight == 0 || full) {
+		return chosen, nil, nil
+	}
+	if full {
+		return nil, p.dialed, nil
+	}
+	p.dialing++
+	return nil, nil, nil
+}
+
+// dial -> dial a new connection in the reserved slot
+func (p *connPool) dial(ctx context.Context) (*clientConn, error) {
+	conn, err := p.factory(ctx)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.dialing--
+	close(p.dialed)
+	p.dialed = make(chan struct{})
+	if err != nil {
+		// we can still use a busy connection
+		if chosen, _ := p.leastLoaded(); chosen != nil {
+			return chosen, nil
+		}
+		return nil, err
+	}
+	if p.closed {
+		_ = conn.Close()
+		return nil, errs.ClientClosedError
+	}
+	p.conns = append(p.conns, conn)
+	return conn, nil
+}
+
+// leastLoaded -> the connection with the fewest in-flight calls, the caller must hold the lock
+func (p *connPool) leastLoaded() (*clientConn, int) {
+	var chosen *clientConn
+	chosenInflight := 0
+	for _, c := range p.conns {
+		inflight := c.inflight()
+		if chosen == nil || inflight < chosenInflight {
+			chosen, chosenInflight = c, inflight
+		}
+	}
+	return chosen, chosenInflight
+}
+
+// Close -> close all connections
+func (p *connPool) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+	for _, c := range p.conns {
+		_ = c.Close()
+	}
+	p.conns = nil
+	return nil
+}
+
+// drain -> stop creating connections, and close the existing ones after their in-flight calls finish
+func (p *connPool) drain() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+	for _, c := range p.conns {
+		c.goAway()
+	}
+	p.conns = nil
+}
@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"context"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/tcp"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnPool_GetWhileDialing(t *testing.T) {
+	release := make(chan struct{})
+	dials := 0
+	pool := newConnPool(func(ctx context.Context) (*clientConn, error) {
+		dials++
+		if dials > 1 {
+			// the second dial hangs until the test releases it
+			<-release
+		}
+		client, _ := net.Pipe()
+		return newClientConn(client, tcp.DefaultMaxFrameSize), nil
+	}, 2)
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	first, err := pool.Get(context.Background())
+	require.NoError(t, err)
+	// the first connection is busy, so the next caller dials a new one
+	require.NoError(t, first.register(1, func(*message2.Response, error) {}))
+
+	dialed := make(chan *clientConn)
+	go func() {
+		conn, er := pool.Get(context.Background())
+		assert.NoError(t, er)
+		dialed <- conn
+	}()
+	assert.Eventually(t, func() bool {
+		pool.mutex.Lock()
+		defer pool.mutex.Unlock()
+		return pool.dialing == 1
+	}, time.Second, time.Millisecond*10)
+
+	// all slots are taken, the busy connection is used without waiting for the dialing
+	done := make(chan *clientConn)
+	go func() {
+		conn, er := pool.Get(context.Background())
+		assert.NoError(t, er)
+		done <- conn
+	}()
+	select {
+	case conn := <-done:
+		assert.Same(t, first, conn)
+	case <-time.After(time.Second):
+		t.Fatal("Get is blocked by the dialing")
+	}
+
+	close(release)
+	second := <-dialed
+	assert.NotSame(t, first, second)
+	assert.Len(t, pool.conns, 2)
+}
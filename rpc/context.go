@@ -1,6 +1,35 @@
 package rpc
 
-import "context"
+import (
+	"context"
+	"emicro/rpc/compress"
+	"emicro/rpc/serialize"
+)
+
+// the keys of Request.Meta used by the framework, they can not be used as metadata
+const (
+	metaOneway   = "one-way"
+	metaDeadline = "deadline"
+	// the codes of the serializers and compressors the client accepts for the response, in preference order
+	metaAcceptSerializers = "accept-serializers"
+	metaAcceptCompressors = "accept-compressors"
+)
+
+// isReservedMeta -> whether the key of Request.Meta is used by the framework
+func isReservedMeta(key string) bool {
+	switch key {
+	case metaOneway, metaDeadline, metaAcceptSerializers, metaAcceptCompressors:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsReservedMetadata -> whether the metadata key is used by the framework,
+// the calls with such keys in the outgoing metadata are rejected
+func IsReservedMetadata(key string) bool {
+	return isReservedMeta(key)
+}
 
 type onewayKey struct{}
 
@@ -11,3 +40,43 @@ func CtxWithOneway(ctx context.Context) context.Context {
 func isOneway(ctx context.Context) bool {
 	return ctx.Value(onewayKey{}) != nil
 }
+
+type idempotentKey struct{}
+
+// CtxWithIdempotent -> mark the call as idempotent, it can be retried
+// even if the server may have received it, see RetryPolicy
+func CtxWithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func isIdempotent(ctx context.Context) bool {
+	return ctx.Value(idempotentKey{}) != nil
+}
+
+type serializerKey struct{}
+
+// CtxWithSerializer -> encode the request of the call with s instead of the serializer of the client
+// The server must register s, the response is encoded with it as well unless the client accepts others.
+func CtxWithSerializer(ctx context.Context, s serialize.Serializer) context.Context {
+	return context.WithValue(ctx, serializerKey{}, s)
+}
+
+type compressorKey struct{}
+
+// CtxWithCompressor -> compress the request of the call with c instead of the compressor of the client,
+// the compress threshold of the client doesn't apply
+func CtxWithCompressor(ctx context.Context, c compress.Compressor) context.Context {
+	return context.WithValue(ctx, compressorKey{}, c)
+}
+
+// callCodecs -> the codecs of the call, the ones in ctx take precedence
+func callCodecs(ctx context.Context, serializer serialize.Serializer,
+	compressor compress.Compressor) (serialize.Serializer, compress.Compressor) {
+	if s, ok := ctx.Value(serializerKey{}).(serialize.Serializer); ok {
+		serializer = s
+	}
+	if c, ok := ctx.Value(compressorKey{}).(compress.Compressor); ok {
+		compressor = c
+	}
+	return serializer, compressor
+}
@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	message2 "emicro/rpc/message"
+	"emicro/rpc/status"
+	"errors"
+)
+
+// setResponseError -> framework errors and business errors are sent separately
+// *status.Error goes to the Code/Error/ErrorDetails fields,
+// the others are considered as business errors.
+func setResponseError(resp *message2.Response, err error) {
+	if err == nil {
+		return
+	}
+	if se, ok := status.FromError(err); ok {
+		code := se.Code
+		// OK means no error on the wire
+		if code == status.OK {
+			code = status.Unknown
+		}
+		resp.Code = uint16(code)
+		resp.Error = []byte(se.Message)
+		resp.ErrorDetails = se.Details
+		return
+	}
+	var be *status.BizError
+	if errors.As(err, &be) {
+		resp.BizError = []byte(be.Message)
+		return
+	}
+	resp.BizError = []byte(err.Error())
+}
+
+// responseError -> convert the error fields of the response back to a typed error
+// Callers can use errors.As with *status.Error and *status.BizError to inspect it.
+func responseError(resp *message2.Response) error {
+	if resp.Code != uint16(status.OK) {
+		return &status.Error{
+			Code:    status.Code(resp.Code),
+			Message: string(resp.Error),
+			Details: resp.ErrorDetails,
+		}
+	}
+	if len(resp.BizError) > 0 {
+		return status.NewBizError(string(resp.BizError))
+	}
+	return nil
+}
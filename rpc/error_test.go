@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	message2 "emicro/rpc/message"
+	"emicro/rpc/status"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		wantResp *message2.Response
+		wantErr  error
+	}{
+		{
+			name:     "nil",
+			wantResp: &message2.Response{},
+		},
+		{
+			name: "business error",
+			err:  errors.New("user not found"),
+			wantResp: &message2.Response{
+				BizError: []byte("user not found"),
+			},
+			wantErr: status.NewBizError("user not found"),
+		},
+		{
+			name: "status error",
+			err:  fmt.Errorf("wrapped: %w", status.New(status.NotFound, "no method").WithDetails([]byte("details"))),
+			wantResp: &message2.Response{
+				Code:         uint16(status.NotFound),
+				Error:        []byte("no method"),
+				ErrorDetails: []byte("details"),
+			},
+			wantErr: &status.Error{Code: status.NotFound, Message: "no method", Details: []byte("details")},
+		},
+		{
+			name: "status ok",
+			err:  status.New(status.OK, "strange"),
+			wantResp: &message2.Response{
+				Code:  uint16(status.Unknown),
+				Error: []byte("strange"),
+			},
+			wantErr: status.New(status.Unknown, "strange"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &message2.Response{}
+			setResponseError(resp, tc.err)
+			assert.Equal(t, tc.wantResp, resp)
+			assert.Equal(t, tc.wantErr, responseError(resp))
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"emicro/rpc/status"
+	"sync"
+)
+
+// executor -> limits the concurrency of the server
+// maxConcurrency workers run the requests, and at most queueSize requests wait in the queue
+// for a free worker. A service may have its own limit, the requests beyond it are rejected
+// immediately instead of waiting, so a slow service can not fill up the queue.
+// The rejected requests are never executed, so the clients can retry them safely.
+type executor struct {
+	// nil means no limit, every request runs in its own goroutine
+	tasks chan executorTask
+	// the concurrency limits of the services
+	services map[string]chan struct{}
+	// guards the send to tasks against stop
+	mutex sync.RWMutex
+	// closed by stop, the workers exit
+	done chan struct{}
+}
+
+// executorTask -> a request waiting in the queue
+type executorTask struct {
+	ctx     context.Context
+	run     func(err error)
+	release func()
+}
+
+func newExecutor(maxConcurrency, queueSize int, serviceLimits map[string]int) *executor {
+	e := &executor{
+		services: make(map[string]chan struct{}, len(serviceLimits)),
+		done:     make(chan struct{}),
+	}
+	for name, limit := range serviceLimits {
+		if limit > 0 {
+			e.services[name] = make(chan struct{}, limit)
+		}
+	}
+	if maxConcurrency > 0 {
+		e.tasks = make(chan executorTask, queueSize)
+		for i := 0; i < maxConcurrency; i++ {
+			go e.work()
+		}
+	}
+	return e
+}
+
+// execute -> run task by a worker when there is room for it
+// task is called exactly once: with nil when it can run, with the server busy error
+// if it's rejected, or with ctx.Err() if ctx is done while it's waiting in the queue.
+// The rejection is reported synchronously so that the client gets it quickly.
+func (e *executor) execute(ctx context.Context, serviceName string, task func(err error)) {
+	svc := e.services[serviceName]
+	if svc != nil {
+		select {
+		case svc <- struct{}{}:
+		default:
+			task(serverBusy(errs.ServiceBusy(serviceName)))
+			return
+		}
+	}
+	release := func() {
+		if svc != nil {
+			<-svc
+		}
+	}
+	if e.tasks == nil {
+		go func() {
+			defer release()
+			task(nil)
+		}()
+		return
+	}
+
+	if err := e.enqueue(executorTask{ctx: ctx, run: task, release: release}); err != nil {
+		release()
+		task(err)
+	}
+}
+
+// enqueue -> put t into the queue without waiting,
+// it fails if the queue is full or the executor is stopped
+func (e *executor) enqueue(t executorTask) error {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	select {
+	case <-e.done:
+		return context.Canceled
+	default:
+	}
+	select {
+	case e.tasks <- t:
+		return nil
+	default:
+		return serverBusy(errs.ServerBusyError)
+	}
+}
+
+// work -> run the queued tasks until the executor is stopped
+func (e *executor) work() {
+	for {
+		select {
+		case t := <-e.tasks:
+			e.runTask(t)
+		case <-e.done:
+			// no task is queued after done is closed, cancel the remaining ones
+			for {
+				select {
+				case t := <-e.tasks:
+					t.release()
+					t.run(context.Canceled)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *executor) runTask(t executorTask) {
+	defer t.release()
+	select {
+	case <-e.done:
+		t.run(context.Canceled)
+		return
+	default:
+	}
+	// the request expires in the queue, it's not executed
+	if err := t.ctx.Err(); err != nil {
+		t.run(err)
+		return
+	}
+	t.run(nil)
+}
+
+// stop -> stop the workers, the queued tasks are called with context.Canceled instead of running
+func (e *executor) stop() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	select {
+	case <-e.done:
+	default:
+		close(e.done)
+	}
+}
+
+// serverBusyDetails -> the details of the rejected requests,
+// they tell the rejection from the ResourceExhausted errors returned by the services
+const serverBusyDetails = "emicro.server-busy"
+
+// serverBusy -> the status error of the rejected request
+func serverBusy(err error) error {
+	return status.New(status.ResourceExhausted, err.Error()).WithDetails([]byte(serverBusyDetails))
+}
+
+// IsServerBusy -> whether the call is rejected by the server because it's saturated
+// The request was not executed, so it can be retried, preferably on another instance.
+func IsServerBusy(err error) bool {
+	se, ok := status.FromError(err)
+	return ok && se.Code == status.ResourceExhausted && string(se.Details) == serverBusyDetails
+}
@@ -0,0 +1,130 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"emicro/rpc/status"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutor(t *testing.T) {
+	e := newExecutor(2, 1, map[string]int{"order-service": 1})
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	results := make(chan error, 8)
+	// a task is sent to it when a worker starts running it
+	started := make(chan struct{}, 8)
+	run := func(ctx context.Context, serviceName string) {
+		wg.Add(1)
+		e.execute(ctx, serviceName, func(err error) {
+			defer wg.Done()
+			if err == nil {
+				started <- struct{}{}
+				<-block
+			}
+			results <- err
+		})
+	}
+
+	// takes the only slot of order-service
+	run(context.Background(), "order-service")
+	<-started
+	// rejected by the limit of order-service
+	run(context.Background(), "order-service")
+	assert.True(t, IsServerBusy(<-results))
+
+	run(context.Background(), "user-service")
+	<-started
+	// queued
+	ctx, cancel := context.WithCancel(context.Background())
+	run(ctx, "user-service")
+	// the queue is full
+	run(context.Background(), "user-service")
+	err := <-results
+	assert.True(t, IsServerBusy(err))
+	assert.False(t, IsServerBusy(status.New(status.ResourceExhausted, "quota exceeded")))
+	// the message is not checked, a service may return the same text
+	assert.False(t, IsServerBusy(status.New(status.ResourceExhausted, errs.ServerBusyError.Error())))
+
+	// the queued one expires before a worker takes it, so it's not executed
+	cancel()
+	close(block)
+	canceled := 0
+	for i := 0; i < 3; i++ {
+		if err = <-results; err == context.Canceled {
+			canceled++
+			continue
+		}
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, canceled)
+
+	// runs after the workers are free
+	run(context.Background(), "user-service")
+	assert.NoError(t, <-results)
+	wg.Wait()
+}
+
+func TestExecutor_unlimited(t *testing.T) {
+	e := newExecutor(0, 0, nil)
+	var wg sync.WaitGroup
+	block := make(chan struct{})
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		e.execute(context.Background(), "user-service", func(err error) {
+			defer wg.Done()
+			assert.NoError(t, err)
+			<-block
+		})
+	}
+	close(block)
+	wg.Wait()
+}
+
+func TestServer_MaxConcurrency(t *testing.T) {
+	server := NewServer(ServerWithMaxConcurrency(1, 0))
+	_ = server.RegisterService(&echoService{})
+	go func() {
+		err := server.Start(":8097")
+		t.Log(err)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	time.Sleep(time.Second)
+
+	client, err := NewClient(":8097")
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	retryClient, err := NewClient(":8097", ClientWithRetryPolicy(RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Millisecond * 100,
+	}))
+	require.NoError(t, err)
+	defer func() {
+		_ = retryClient.Close()
+	}()
+
+	slow := client.CallAsync(context.Background(), "user-service", "GetById", &GetByIdReq{Id: 200}, &GetByIdResp{})
+	time.Sleep(time.Millisecond * 50)
+	start := time.Now()
+	err = client.Call(context.Background(), "user-service", "GetById", &GetByIdReq{Id: 1}, &GetByIdResp{})
+	assert.True(t, IsServerBusy(err))
+	assert.ErrorContains(t, err, errs.ServerBusyError.Error())
+	// rejected without waiting
+	assert.Less(t, time.Since(start), time.Millisecond*100)
+
+	// the rejected call was not executed, so it's retried even if it's not idempotent
+	out := &GetByIdResp{}
+	err = retryClient.Call(context.Background(), "user-service", "GetById", &GetByIdReq{Id: 1}, out)
+	require.NoError(t, err)
+	assert.Equal(t, "1", out.Msg)
+	assert.NoError(t, slow.Wait())
+}
@@ -0,0 +1,216 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	message2 "emicro/rpc/message"
+	"sync"
+	"sync/atomic"
+)
+
+// Future -> the handle of an asynchronous call
+// The call is completed by the reader goroutine of the connection when the response arrives,
+// so issuing many calls doesn't need a goroutine per call.
+type Future struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mutex     sync.Mutex
+	completed bool
+	// stops watching ctx after the call is completed
+	stop func() bool
+	resp *message2.Response
+	err  error
+
+	// called when the call is completed, for example to report the result to the balancer
+	onComplete func(resp *message2.Response, err error)
+	// decode the response into out, nil for InvokeAsync
+	decode     func(resp *message2.Response) error
+	decodeOnce sync.Once
+	result     error
+	// callback of CallWithCallback
+	callback func(err error)
+}
+
+func newFuture(ctx context.Context) *Future {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Future{
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// Done -> closed when the call is completed, cancelled or failed
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait -> wait for the call to complete, and return its error.
+// For CallAsync, the response is decoded into out before Wait returns,
+// and the service may return both data and error just like Call.
+func (f *Future) Wait() error {
+	<-f.done
+	f.decodeOnce.Do(func() {
+		f.result = f.err
+		if f.err == nil {
+			f.result = responseError(f.resp)
+		}
+		if f.decode != nil && f.resp != nil {
+			if err := f.decode(f.resp); err != nil {
+				f.result = err
+			}
+		}
+	})
+	return f.result
+}
+
+// Response -> the raw response, nil before the call is completed or if it failed
+func (f *Future) Response() *message2.Response {
+	select {
+	case <-f.done:
+		return f.resp
+	default:
+		return nil
+	}
+}
+
+// Cancel -> stop waiting for the response, Wait returns context.Canceled.
+// If the request has been sent, the server is told to cancel the context of the method,
+// but the method may have done some work already.
+func (f *Future) Cancel() {
+	f.cancel()
+}
+
+// setStop -> stop is called as soon as the call is completed
+func (f *Future) setStop(stop func() bool) {
+	f.mutex.Lock()
+	if !f.completed {
+		f.stop = stop
+		stop = nil
+	}
+	f.mutex.Unlock()
+	if stop != nil {
+		stop()
+	}
+}
+
+// complete -> only the first result counts
+func (f *Future) complete(resp *message2.Response, err error) {
+	f.mutex.Lock()
+	if f.completed {
+		f.mutex.Unlock()
+		return
+	}
+	f.completed = true
+	f.resp, f.err = resp, err
+	stop := f.stop
+	f.mutex.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+	if f.onComplete != nil {
+		f.onComplete(resp, err)
+	}
+	close(f.done)
+	f.cancel()
+	if f.callback != nil {
+		// the callback is user code, it must not block the reader goroutine
+		go func() {
+			f.callback(f.Wait())
+		}()
+	}
+}
+
+// InvokeAsync -> send the request without waiting for the response
+// The request goes to the connection directly and no goroutine is started.
+// If the client has interceptors, or the method has a retry policy,
+// the call runs Invoke in a new goroutine instead, so that they still apply.
+func (c *Client) InvokeAsync(ctx context.Context, request *message2.Request) *Future {
+	return c.invokeAsync(newFuture(ctx), request)
+}
+
+func (c *Client) invokeAsync(f *Future, request *message2.Request) *Future {
+	if err := f.ctx.Err(); err != nil {
+		f.complete(nil, err)
+		return f
+	}
+	if request.MessageId == 0 {
+		request.MessageId = atomic.AddUint32(&messageId, +1)
+	}
+	if len(c.interceptors) > 0 || c.retryPolicy(request.ServiceName, request.MethodName).MaxAttempts > 1 {
+		go func() {
+			f.complete(c.Invoke(f.ctx, request))
+		}()
+		return f
+	}
+	if err := checkLimits(request); err != nil {
+		f.complete(nil, err)
+		return f
+	}
+	conn, done, err := c.getConn(f.ctx)
+	if err != nil {
+		f.complete(nil, errs.ClientConnDeaded(err))
+		return f
+	}
+	f.onComplete = func(resp *message2.Response, err error) {
+		if err == nil {
+			err = responseError(resp)
+		}
+		done(err)
+	}
+	conn.start(f, request)
+	return f
+}
+
+// CallAsync -> the asynchronous Call, out is filled when Wait returns
+func (c *Client) CallAsync(ctx context.Context, serviceName, methodName string, in, out any) *Future {
+	return c.callAsync(newFuture(ctx), serviceName, methodName, in, out)
+}
+
+// CallWithCallback -> the asynchronous Call, callback is called in a new goroutine
+// with the error of the call after out is filled.
+func (c *Client) CallWithCallback(ctx context.Context, serviceName, methodName string,
+	in, out any, callback func(err error)) *Future {
+	f := newFuture(ctx)
+	f.callback = callback
+	return c.callAsync(f, serviceName, methodName, in, out)
+}
+
+func (c *Client) callAsync(f *Future, serviceName, methodName string, in, out any) *Future {
+	serializer, compressor := callCodecs(f.ctx, c.serializer, c.compressor)
+	reqData, err := serializer.Encode(in)
+	if err != nil {
+		f.complete(nil, err)
+		return f
+	}
+	compressor = chooseCompressor(compressor, len(reqData))
+	reqData, err = compressor.Compress(reqData)
+	if err != nil {
+		f.complete(nil, err)
+		return f
+	}
+	req, err := newRequest(f.ctx, serializer, compressor, serviceName, methodName, reqData)
+	if err != nil {
+		f.complete(nil, err)
+		return f
+	}
+	serializers, compressors := acceptCodecs(c, req, serializer)
+	f.decode = func(resp *message2.Response) error {
+		if len(resp.Data) == 0 {
+			return nil
+		}
+		respSerializer, respCompressor, err := responseCodecs(resp, serializer, compressor, serializers, compressors)
+		if err != nil {
+			return err
+		}
+		data, err := respCompressor.UnCompress(resp.Data)
+		if err != nil {
+			return err
+		}
+		return respSerializer.Decode(data, out)
+	}
+	return c.invokeAsync(f, req)
+}
@@ -0,0 +1,178 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/status"
+	"emicro/rpc/tcp"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ekit/bean/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoService -> echoes the id after sleeping for id milliseconds
+type echoService struct{}
+
+func (e *echoService) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	time.Sleep(time.Duration(req.Id) * time.Millisecond)
+	if req.Id < 0 {
+		return &GetByIdResp{Msg: "negative"}, status.NewBizError("invalid id")
+	}
+	return &GetByIdResp{Msg: strconv.Itoa(req.Id)}, nil
+}
+
+func (e *echoService) Name() string {
+	return "user-service"
+}
+
+func TestClient_CallAsync(t *testing.T) {
+	server := NewServer()
+	_ = server.RegisterService(&echoService{})
+	go func() {
+		err := server.Start(":8096")
+		t.Log(err)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	time.Sleep(time.Second)
+
+	var intercepted int32
+	interceptor := func(ctx context.Context, req *message2.Request, invoker UnaryInvoker) (*message2.Response, error) {
+		atomic.AddInt32(&intercepted, 1)
+		return invoker(ctx, req)
+	}
+	clients := map[string]*Client{}
+	for name, opts := range map[string][]option.Option[Client]{
+		"direct":      nil,
+		"interceptor": {ClientWithInterceptors(interceptor)},
+	} {
+		client, err := NewClient(":8096", opts...)
+		require.NoError(t, err)
+		defer func() {
+			_ = client.Close()
+		}()
+		clients[name] = client
+	}
+
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			t.Run("wait", func(t *testing.T) {
+				const cnt = 100
+				futures := make([]*Future, 0, cnt)
+				outs := make([]*GetByIdResp, 0, cnt)
+				for i := 0; i < cnt; i++ {
+					out := &GetByIdResp{}
+					// the later calls respond earlier
+					futures = append(futures, client.CallAsync(context.Background(), "user-service", "GetById",
+						&GetByIdReq{Id: (cnt - i) * 2}, out))
+					outs = append(outs, out)
+				}
+				for i, f := range futures {
+					require.NoError(t, f.Wait())
+					assert.Equal(t, strconv.Itoa((cnt-i)*2), outs[i].Msg)
+					assert.NotNil(t, f.Response())
+				}
+			})
+
+			t.Run("callback", func(t *testing.T) {
+				var wg sync.WaitGroup
+				for i := -1; i < 10; i++ {
+					wg.Add(1)
+					out := &GetByIdResp{}
+					id := i
+					client.CallWithCallback(context.Background(), "user-service", "GetById",
+						&GetByIdReq{Id: id}, out, func(err error) {
+							defer wg.Done()
+							if id < 0 {
+								assert.Equal(t, status.NewBizError("invalid id"), err)
+								assert.Equal(t, "negative", out.Msg)
+								return
+							}
+							assert.NoError(t, err)
+							assert.Equal(t, strconv.Itoa(id), out.Msg)
+						})
+				}
+				wg.Wait()
+			})
+
+			t.Run("cancel", func(t *testing.T) {
+				f := client.CallAsync(context.Background(), "user-service", "GetById",
+					&GetByIdReq{Id: 1000}, &GetByIdResp{})
+				start := time.Now()
+				f.Cancel()
+				<-f.Done()
+				assert.Equal(t, context.Canceled, f.Wait())
+				assert.Less(t, time.Since(start), time.Millisecond*100)
+				assert.Nil(t, f.Response())
+			})
+
+			t.Run("timeout", func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+				defer cancel()
+				f := client.CallAsync(ctx, "user-service", "GetById", &GetByIdReq{Id: 1000}, &GetByIdResp{})
+				assert.Equal(t, context.DeadlineExceeded, f.Wait())
+			})
+
+			t.Run("oneway", func(t *testing.T) {
+				f := client.CallAsync(CtxWithOneway(context.Background()), "user-service", "GetById",
+					&GetByIdReq{Id: 1}, &GetByIdResp{})
+				assert.Equal(t, errs.OnewayError, f.Wait())
+			})
+		})
+	}
+	assert.Greater(t, atomic.LoadInt32(&intercepted), int32(100))
+}
+
+func TestClientConn_start(t *testing.T) {
+	client, server := net.Pipe()
+	cc := newClientConn(client, tcp.DefaultMaxFrameSize)
+
+	go func() {
+		bs, err := tcp.ReadMsg(server)
+		if err != nil {
+			return
+		}
+		req, err := message2.DecodeReq(bs)
+		if err != nil {
+			return
+		}
+		resp := &message2.Response{Version: message2.ProtocolVersion, MessageId: req.MessageId, Data: []byte("ok")}
+		resp.CalculateHeaderLength()
+		resp.CalculateBodyLength()
+		_ = tcp.WriteMsg(server, message2.EncodeResp(resp))
+		_, _ = tcp.ReadMsg(server)
+		// the peer goes away without responding the second call
+		_ = server.Close()
+	}()
+
+	var results []string
+	for i := 1; i <= 2; i++ {
+		f := newFuture(context.Background())
+		f.onComplete = func(resp *message2.Response, err error) {
+			results = append(results, fmt.Sprint(resp != nil, err != nil))
+		}
+		req := &message2.Request{MessageId: uint32(i), ServiceName: "user-service", MethodName: "GetById"}
+		req.CalculateHeaderLength()
+		cc.start(f, req)
+		err := f.Wait()
+		if i == 1 {
+			require.NoError(t, err)
+			assert.Equal(t, []byte("ok"), f.Response().Data)
+			continue
+		}
+		assert.ErrorIs(t, err, io.EOF)
+	}
+	assert.Equal(t, []string{"true false", "false true"}, results)
+	assert.Equal(t, 0, cc.inflight())
+}
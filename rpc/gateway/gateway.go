@@ -0,0 +1,242 @@
+package gateway
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"emicro/rpc"
+	"emicro/rpc/metadata"
+	"emicro/rpc/status"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ekit/bean/option"
+)
+
+const (
+	// HeaderTimeout -> the timeout of the call in the format of time.ParseDuration, e.g. 500ms
+	HeaderTimeout = "Emicro-Timeout"
+	// HeaderMetadataPrefix -> the headers with this prefix are sent as metadata without the prefix,
+	// e.g. Emicro-Metadata-Tenant-Id: 1 becomes tenant-id: 1
+	HeaderMetadataPrefix = "Emicro-Metadata-"
+)
+
+// defaultMaxBodySize -> the same as the default maximum frame size of rpc
+const defaultMaxBodySize = 4 << 20
+
+// Backend -> where the gateway sends the calls
+// *rpc.Server calls the services in the same process, and *rpc.Client proxies the calls to the remote servers.
+type Backend interface {
+	InvokeJSON(ctx context.Context, serviceName, methodName string, doc []byte) ([]byte, error)
+}
+
+var (
+	_ Backend = (*rpc.Server)(nil)
+	_ Backend = (*rpc.Client)(nil)
+)
+
+// Handler -> HTTP/JSON gateway, POST /{service}/{method} with a JSON body calls the method,
+// and the JSON response is written back. Mount it under a prefix with http.StripPrefix.
+type Handler struct {
+	backend Backend
+	// the canonical names of the headers sent as metadata as they are
+	forwardHeaders []string
+	maxBodySize    int64
+}
+
+// NewHandler -> create the gateway in front of backend
+func NewHandler(backend Backend, opts ...option.Option[Handler]) *Handler {
+	res := &Handler{
+		backend:     backend,
+		maxBodySize: defaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// WithForwardHeaders -> the headers sent as metadata in addition to the ones with HeaderMetadataPrefix,
+// e.g. Authorization becomes the metadata authorization
+func WithForwardHeaders(names ...string) option.Option[Handler] {
+	return func(h *Handler) {
+		for _, name := range names {
+			h.forwardHeaders = append(h.forwardHeaders, http.CanonicalHeaderKey(name))
+		}
+	}
+}
+
+// WithMaxBodySize -> the requests with a larger body are rejected with 413
+func WithMaxBodySize(size int64) option.Option[Handler] {
+	return func(h *Handler) {
+		h.maxBodySize = size
+	}
+}
+
+// ErrorBody -> the body of the failed calls
+type ErrorBody struct {
+	// the name of status.Code, empty for the business errors
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Details []byte `json:"details,omitempty"`
+	// the error is returned by the method, see status.BizError
+	Business bool `json:"business,omitempty"`
+	// the data returned along with the business error
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, &ErrorBody{Message: "only POST is allowed"})
+		return
+	}
+	serviceName, methodName, ok := strings.Cut(strings.Trim(r.URL.Path, "/"), "/")
+	if !ok || serviceName == "" || methodName == "" || strings.Contains(methodName, "/") {
+		writeError(w, http.StatusNotFound, &ErrorBody{Message: "the path must be /{service}/{method}"})
+		return
+	}
+	doc, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			writeError(w, http.StatusRequestEntityTooLarge, &ErrorBody{Message: err.Error()})
+			return
+		}
+		writeError(w, http.StatusBadRequest, &ErrorBody{Message: err.Error()})
+		return
+	}
+	if len(doc) == 0 {
+		doc = []byte("{}")
+	}
+
+	ctx, cancel, err := h.newContext(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &ErrorBody{Code: status.InvalidArgument.String(), Message: err.Error()})
+		return
+	}
+	defer cancel()
+	data, err := h.backend.InvokeJSON(ctx, serviceName, methodName, doc)
+	if err != nil {
+		writeCallError(w, err, data)
+		return
+	}
+	if len(data) == 0 {
+		data = []byte("null")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// newContext -> the metadata and the deadline of the call
+// The call is canceled as well if the HTTP client goes away.
+func (h *Handler) newContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	md := metadata.MD{}
+	for name, values := range r.Header {
+		key, ok := strings.CutPrefix(name, HeaderMetadataPrefix)
+		if !ok {
+			if !h.forward(name) {
+				continue
+			}
+			key = name
+		}
+		key = strings.ToLower(key)
+		if rpc.IsReservedMetadata(key) {
+			return nil, nil, errs.ReservedMetadata(key)
+		}
+		md.Set(key, strings.Join(values, ", "))
+	}
+	if err := metadata.Validate(md); err != nil {
+		return nil, nil, err
+	}
+	ctx := r.Context()
+	if md.Len() > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+	if timeout := r.Header.Get(HeaderTimeout); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return nil, nil, errs.InvalidTimeout(timeout)
+		}
+		ctx, cancel := context.WithTimeout(ctx, d)
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, cancel, nil
+}
+
+func (h *Handler) forward(name string) bool {
+	for _, header := range h.forwardHeaders {
+		if header == name {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCallError -> the business errors are 422 with the data returned by the method,
+// the status errors are mapped by HTTPStatus
+func writeCallError(w http.ResponseWriter, err error, data []byte) {
+	if errors.Is(err, errs.InvalidJSONError) {
+		writeError(w, http.StatusBadRequest, &ErrorBody{Code: status.InvalidArgument.String(), Message: err.Error()})
+		return
+	}
+	var be *status.BizError
+	if errors.As(err, &be) {
+		body := &ErrorBody{Message: be.Message, Business: true}
+		if len(data) > 0 {
+			body.Data = data
+		}
+		writeError(w, http.StatusUnprocessableEntity, body)
+		return
+	}
+	code := status.CodeOf(err)
+	body := &ErrorBody{Code: code.String(), Message: err.Error()}
+	if se, ok := status.FromError(err); ok {
+		body.Message = se.Message
+		body.Details = se.Details
+	}
+	writeError(w, HTTPStatus(code), body)
+}
+
+func writeError(w http.ResponseWriter, httpStatus int, body *ErrorBody) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// HTTPStatus -> the HTTP status code of the rpc status code, the same mapping as grpc-gateway
+func HTTPStatus(code status.Code) int {
+	switch code {
+	case status.OK:
+		return http.StatusOK
+	case status.Canceled:
+		// Client Closed Request, nginx
+		return 499
+	case status.InvalidArgument, status.FailedPrecondition, status.OutOfRange:
+		return http.StatusBadRequest
+	case status.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case status.NotFound:
+		return http.StatusNotFound
+	case status.AlreadyExists, status.Aborted:
+		return http.StatusConflict
+	case status.PermissionDenied:
+		return http.StatusForbidden
+	case status.Unauthenticated:
+		return http.StatusUnauthorized
+	case status.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case status.Unimplemented:
+		return http.StatusNotImplemented
+	case status.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		// Unknown, Internal, DataLoss
+		return http.StatusInternalServerError
+	}
+}
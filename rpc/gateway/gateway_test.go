@@ -0,0 +1,188 @@
+package gateway
+
+import (
+	"context"
+	"emicro/rpc"
+	"emicro/rpc/metadata"
+	"emicro/rpc/status"
+	"emicro/rpc/transport"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type GetByIdReq struct {
+	Id int `json:"id"`
+}
+
+type GetByIdResp struct {
+	Msg    string `json:"msg"`
+	Tenant string `json:"tenant,omitempty"`
+}
+
+type userService struct{}
+
+func (u *userService) Name() string {
+	return "user-service"
+}
+
+func (u *userService) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	switch {
+	case req.Id < 0:
+		return &GetByIdResp{Msg: "negative"}, status.NewBizError("invalid id")
+	case req.Id == 0:
+		return nil, status.New(status.NotFound, "user not found").WithDetails([]byte("0"))
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return &GetByIdResp{Msg: "hello", Tenant: md.Get("tenant-id") + md.Get("authorization")}, nil
+}
+
+func (u *userService) Sleep(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	select {
+	case <-ctx.Done():
+		return nil, status.New(status.DeadlineExceeded, ctx.Err().Error())
+	case <-time.After(time.Second):
+		return &GetByIdResp{}, nil
+	}
+}
+
+func TestHandler(t *testing.T) {
+	mem := transport.NewMemory(0)
+	server := rpc.NewServer(rpc.ServerWithTransport(mem))
+	require.NoError(t, server.RegisterService(&userService{}))
+	listener, err := mem.Listen("user-service")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	client, err := rpc.NewClient("user-service", rpc.ClientWithTransport(mem))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		header     http.Header
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "ok",
+			method:     http.MethodPost,
+			path:       "/user-service/GetById",
+			body:       `{"id":1}`,
+			header:     http.Header{"Emicro-Metadata-Tenant-Id": {"t1"}, "Authorization": {"Bearer x"}},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"msg":"hello","tenant":"t1Bearer x"}`,
+		},
+		{
+			name:       "status error",
+			method:     http.MethodPost,
+			path:       "/user-service/GetById",
+			body:       `{"id":0}`,
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"code":"NotFound","message":"user not found","details":"MA=="}`,
+		},
+		{
+			name:       "business error",
+			method:     http.MethodPost,
+			path:       "/user-service/GetById",
+			body:       `{"id":-1}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `{"message":"invalid id","business":true,"data":{"msg":"negative"}}`,
+		},
+		{
+			name:       "deadline",
+			method:     http.MethodPost,
+			path:       "/user-service/Sleep",
+			header:     http.Header{HeaderTimeout: {"50ms"}},
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "invalid timeout",
+			method:     http.MethodPost,
+			path:       "/user-service/Sleep",
+			header:     http.Header{HeaderTimeout: {"soon"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "reserved metadata",
+			method:     http.MethodPost,
+			path:       "/user-service/GetById",
+			header:     http.Header{"Emicro-Metadata-Deadline": {"1"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid json",
+			method:     http.MethodPost,
+			path:       "/user-service/GetById",
+			body:       `{"id":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown method",
+			method:     http.MethodPost,
+			path:       "/user-service/Delete",
+			wantStatus: http.StatusNotImplemented,
+		},
+		{
+			name:       "invalid path",
+			method:     http.MethodPost,
+			path:       "/user-service",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "get",
+			method:     http.MethodGet,
+			path:       "/user-service/GetById",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "body too large",
+			method:     http.MethodPost,
+			path:       "/user-service/GetById",
+			body:       `{"id":1,"padding":"` + strings.Repeat("a", 1024) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+	backends := map[string]Backend{
+		"in process": server,
+		"proxy":      client,
+	}
+	for name, backend := range backends {
+		handler := NewHandler(backend, WithForwardHeaders("authorization"), WithMaxBodySize(1024))
+		for _, tc := range testCases {
+			t.Run(name+" "+tc.name, func(t *testing.T) {
+				req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+				for k, v := range tc.header {
+					req.Header[k] = v
+				}
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, req)
+				assert.Equal(t, tc.wantStatus, recorder.Code)
+				assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+				if tc.wantBody != "" {
+					assert.JSONEq(t, tc.wantBody, recorder.Body.String())
+				}
+				if recorder.Code != http.StatusOK {
+					body := &ErrorBody{}
+					require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), body))
+					assert.NotEmpty(t, body.Message)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"emicro/rpc/compress"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/metadata"
+	"emicro/rpc/serialize"
+	"emicro/rpc/serialize/json"
+	encjson "encoding/json"
+)
+
+// InvokeRaw -> call the method without its Go types, e.g. in ops tools and gateways
+// data is encoded by the caller with the serializer of the code, the server decodes it by the serializer
+// registered with the same code, and the returned data is encoded by it as well.
+// The data of the response is returned along with the business error if the method returns both.
+// Like Call, the data is compressed by the compressor of the client and the outgoing metadata is sent.
+func (c *Client) InvokeRaw(ctx context.Context, serviceName, methodName string,
+	serializer uint8, data []byte) ([]byte, error) {
+	var out []byte
+	err := c.CallWithSerializer(ctx, rawSerializer{code: serializer}, serviceName, methodName, data, &out)
+	return out, err
+}
+
+// InvokeJSON -> call the method with a JSON document, the response is a JSON document as well
+// The server must register the json serializer, which is registered by default.
+func (c *Client) InvokeJSON(ctx context.Context, serviceName, methodName string, doc []byte) ([]byte, error) {
+	if !encjson.Valid(doc) {
+		return nil, errs.InvalidJSONError
+	}
+	return c.InvokeRaw(ctx, serviceName, methodName, json.Serializer{}.Code(), doc)
+}
+
+// CallWithSerializer -> Call with the serializer chosen for this call instead of the one of the client,
+// e.g. a map[string]any can be sent and received with json.Serializer{}
+func (c *Client) CallWithSerializer(ctx context.Context, serializer serialize.Serializer,
+	serviceName, methodName string, in, out any) error {
+	return call(ctx, serializer, c.compressor, c, serviceName, methodName, in, out)
+}
+
+// InvokeJSON -> call the method in process with a JSON document, e.g. by the HTTP gateway
+// The outgoing metadata of ctx becomes the incoming metadata of the method,
+// and the call goes through the interceptors as the remote ones do.
+// The method runs in the goroutine of the caller, so the concurrency limits don't apply.
+func (s *Server) InvokeJSON(ctx context.Context, serviceName, methodName string, doc []byte) ([]byte, error) {
+	if !encjson.Valid(doc) {
+		return nil, errs.InvalidJSONError
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if err := metadata.Validate(md); err != nil {
+		return nil, err
+	}
+	meta := make(map[string]string, len(md))
+	for k, v := range md {
+		if isReservedMeta(k) {
+			return nil, errs.ReservedMetadata(k)
+		}
+		meta[k] = v
+	}
+	req := &message2.Request{
+		Meta:        meta,
+		Version:     message2.ProtocolVersion,
+		Compresser:  compress.DoNothingCompressor{}.Code(),
+		Serializer:  json.Serializer{}.Code(),
+		ServiceName: serviceName,
+		MethodName:  methodName,
+		Data:        doc,
+	}
+	req.CalculateHeaderLength()
+	req.CalculateBodyLength()
+	// the same limits as the requests from the clients
+	if err := checkLimits(req); err != nil {
+		return nil, err
+	}
+	ctx = metadata.NewIncomingContext(ctx, md.Copy())
+	resp := s.Invoke(ctx, req)
+	return resp.Data, responseError(resp)
+}
+
+var _ serialize.Serializer = rawSerializer{}
+
+// rawSerializer -> the data is already encoded by the caller,
+// it only carries the code of the serializer used by the caller
+type rawSerializer struct {
+	code uint8
+}
+
+func (r rawSerializer) Code() byte {
+	return r.code
+}
+
+func (r rawSerializer) Encode(val any) ([]byte, error) {
+	data, ok := val.([]byte)
+	if !ok {
+		return nil, errs.RawDataTypeError
+	}
+	return data, nil
+}
+
+func (r rawSerializer) Decode(data []byte, val any) error {
+	out, ok := val.(*[]byte)
+	if !ok {
+		return errs.RawDataTypeError
+	}
+	*out = data
+	return nil
+}
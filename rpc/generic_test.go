@@ -0,0 +1,93 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"emicro/rpc/compress/gzip"
+	"emicro/rpc/serialize/json"
+	"emicro/rpc/status"
+	"emicro/rpc/transport"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_InvokeJSON(t *testing.T) {
+	mem := transport.NewMemory(0)
+	server := NewServer(ServerWithTransport(mem))
+	server.RegisterCompressor(gzip.Compressor{})
+	require.NoError(t, server.RegisterService(&echoService{}))
+	listener, err := mem.Listen("user-service")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	client, err := NewClient("user-service", ClientWithTransport(mem), ClientWithCompressor(gzip.Compressor{}))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+
+	testCases := []struct {
+		name     string
+		invoke   func() ([]byte, error)
+		wantData string
+		wantErr  error
+	}{
+		{
+			name: "json",
+			invoke: func() ([]byte, error) {
+				return client.InvokeJSON(context.Background(), "user-service", "GetById", []byte(`{"Id":12}`))
+			},
+			wantData: `{"Msg":"12"}`,
+		},
+		{
+			name: "raw",
+			invoke: func() ([]byte, error) {
+				return client.InvokeRaw(context.Background(), "user-service", "GetById",
+					json.Serializer{}.Code(), []byte(`{"Id":3}`))
+			},
+			wantData: `{"Msg":"3"}`,
+		},
+		{
+			name: "both data and error",
+			invoke: func() ([]byte, error) {
+				return client.InvokeJSON(context.Background(), "user-service", "GetById", []byte(`{"Id":-1}`))
+			},
+			wantData: `{"Msg":"negative"}`,
+			wantErr:  status.NewBizError("invalid id"),
+		},
+		{
+			name: "invalid json",
+			invoke: func() ([]byte, error) {
+				return client.InvokeJSON(context.Background(), "user-service", "GetById", []byte(`{"Id":`))
+			},
+			wantErr: errs.InvalidJSONError,
+		},
+		{
+			name: "unknown method",
+			invoke: func() ([]byte, error) {
+				return client.InvokeJSON(context.Background(), "user-service", "Delete", []byte(`{}`))
+			},
+			wantErr: status.New(status.Unimplemented, errs.NotFoundServiceMethod("Delete").Error()),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.invoke()
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantData, string(data))
+		})
+	}
+
+	// decoded without the Go types
+	out := map[string]any{}
+	err = client.CallWithSerializer(context.Background(), json.Serializer{}, "user-service", "GetById",
+		map[string]any{"Id": 7}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"Msg": "7"}, out)
+}
@@ -0,0 +1,165 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/status"
+	"emicro/rpc/tcp"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// handshakeTimeout -> the maximum time of the handshake on both sides
+const handshakeTimeout = time.Second * 5
+
+// supportedVersions -> the protocol versions supported by this package, in preference order
+var supportedVersions = []uint8{message2.ProtocolVersion}
+
+// clientHandshake -> offer the versions and codecs, returns the choice of the server
+// It runs before the reader goroutine of the connection starts,
+// and it's bounded by handshakeTimeout and ctx.
+func clientHandshake(ctx context.Context, conn net.Conn,
+	offer *message2.Handshake, maxFrameSize uint32) (choice *message2.Handshake, err error) {
+	deadline := time.Now().Add(handshakeTimeout)
+	d, ctxDeadline := ctx.Deadline()
+	if ctxDeadline = ctxDeadline && d.Before(deadline); ctxDeadline {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	// interrupt the reading and writing if ctx is cancelled
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer func() {
+		stop()
+		_ = conn.SetDeadline(time.Time{})
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		} else if ctxDeadline && errors.Is(err, os.ErrDeadlineExceeded) {
+			// the connection may time out slightly before ctx
+			err = context.DeadlineExceeded
+		}
+	}()
+	req := &message2.Request{
+		Version:     message2.ProtocolVersion,
+		MessageType: message2.MessageTypeHandshake,
+		Data:        message2.EncodeHandshake(offer),
+	}
+	req.CalculateHeaderLength()
+	req.CalculateBodyLength()
+	if err := tcp.WriteMsg(conn, message2.EncodeReq(req)); err != nil {
+		return nil, err
+	}
+	bs, err := tcp.ReadMsgWithLimit(conn, maxFrameSize)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := message2.DecodeResp(bs)
+	if err != nil {
+		return nil, err
+	}
+	if resp.MessageType != message2.MessageTypeHandshake {
+		return nil, errs.HandshakeFailed(fmt.Sprintf("unexpected message type %d", resp.MessageType))
+	}
+	if err = responseError(resp); err != nil {
+		return nil, err
+	}
+	choice, err = message2.DecodeHandshake(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(choice.Versions) != 1 || !containsCode(offer.Versions, choice.Versions[0]) {
+		return nil, errs.HandshakeFailed(fmt.Sprintf("the server chose versions %v which are not offered", choice.Versions))
+	}
+	return choice, nil
+}
+
+// serverHandshake -> read the offer of the client and reply with the choice
+func (s *Server) serverHandshake(sc *serverConn) error {
+	_ = sc.conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	defer func() {
+		_ = sc.conn.SetReadDeadline(time.Time{})
+	}()
+	bs, err := tcp.ReadMsgWithLimit(sc.conn, s.maxFrameSize)
+	if err != nil {
+		return err
+	}
+	resp := &message2.Response{
+		Version:     message2.ProtocolVersion,
+		MessageType: message2.MessageTypeHandshake,
+	}
+	req, err := message2.DecodeReq(bs)
+	var choice *message2.Handshake
+	if err != nil {
+		err = status.New(status.InvalidArgument, err.Error())
+	} else if req.MessageType != message2.MessageTypeHandshake {
+		err = status.New(status.FailedPrecondition, errs.HandshakeRequiredError.Error())
+	} else {
+		choice, err = s.chooseCodec(req.Data)
+	}
+	if err != nil {
+		setResponseError(resp, err)
+		// the client gets the reason before the connection is closed
+		_ = sc.writeResp(resp)
+		return err
+	}
+	resp.Data = message2.EncodeHandshake(choice)
+	sc.version = choice.Versions[0]
+	return sc.writeResp(resp)
+}
+
+// chooseCodec -> the first version, serializer and compressor in the offer which the server supports
+func (s *Server) chooseCodec(data []byte) (*message2.Handshake, error) {
+	offer, err := message2.DecodeHandshake(data)
+	if err != nil {
+		return nil, status.New(status.InvalidArgument, err.Error())
+	}
+	choice := &message2.Handshake{}
+	for _, v := range offer.Versions {
+		if containsCode(supportedVersions, v) {
+			choice.Versions = []uint8{v}
+			break
+		}
+	}
+	for _, code := range offer.Serializers {
+		if s.serializers[code] != nil {
+			choice.Serializers = []uint8{code}
+			break
+		}
+	}
+	for _, code := range offer.Compressors {
+		if s.compressors[code] != nil {
+			choice.Compressors = []uint8{code}
+			break
+		}
+	}
+	var reason string
+	switch {
+	case len(choice.Versions) == 0:
+		reason = fmt.Sprintf("no common protocol version, client supports %v, server supports %v",
+			offer.Versions, supportedVersions)
+	case len(choice.Serializers) == 0:
+		reason = fmt.Sprintf("the server does not support any serializer of %v", offer.Serializers)
+	case len(choice.Compressors) == 0:
+		reason = fmt.Sprintf("the server does not support any compressor of %v", offer.Compressors)
+	default:
+		return choice, nil
+	}
+	return nil, status.New(status.FailedPrecondition, errs.HandshakeFailed(reason).Error())
+}
+
+func containsCode(codes []uint8, code uint8) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"emicro/rpc/compress"
+	"emicro/rpc/compress/gzip"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/serialize/json"
+	"emicro/rpc/serialize/proto"
+	"emicro/rpc/status"
+	"emicro/rpc/tcp"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandshake(t *testing.T) {
+	server := NewServer()
+	_ = server.RegisterService(&UserServiceServer{Msg: "hello, world"})
+	go func() {
+		err := server.Start(":8086")
+		t.Log(err)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	time.Sleep(time.Second * 3)
+
+	jsonCode := json.Serializer{}.Code()
+	nothingCode := compress.DoNothingCompressor{}.Code()
+	testCases := []struct {
+		name  string
+		offer *message2.Handshake
+
+		wantChoice  *message2.Handshake
+		wantCode    status.Code
+		wantMessage string
+	}{
+		{
+			name: "prefer the client",
+			offer: &message2.Handshake{
+				Versions:    []uint8{9, message2.ProtocolVersion},
+				Serializers: []uint8{proto.Serializer{}.Code(), jsonCode},
+				Compressors: []uint8{gzip.Compressor{}.Code(), nothingCode},
+			},
+			wantChoice: &message2.Handshake{
+				Versions:    []uint8{message2.ProtocolVersion},
+				Serializers: []uint8{jsonCode},
+				Compressors: []uint8{nothingCode},
+			},
+		},
+		{
+			name: "no common version",
+			offer: &message2.Handshake{
+				Versions:    []uint8{9},
+				Serializers: []uint8{jsonCode},
+				Compressors: []uint8{nothingCode},
+			},
+			wantCode:    status.FailedPrecondition,
+			wantMessage: "emicro: handshake failed: no common protocol version, client supports [9], server supports [1]",
+		},
+		{
+			name: "unsupported serializer",
+			offer: &message2.Handshake{
+				Versions:    []uint8{message2.ProtocolVersion},
+				Serializers: []uint8{proto.Serializer{}.Code()},
+				Compressors: []uint8{nothingCode},
+			},
+			wantCode:    status.FailedPrecondition,
+			wantMessage: "emicro: handshake failed: the server does not support any serializer of [2]",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", ":8086")
+			require.NoError(t, err)
+			defer func() {
+				_ = conn.Close()
+			}()
+			choice, err := clientHandshake(context.Background(), conn, tc.offer, tcp.DefaultMaxFrameSize)
+			if tc.wantMessage != "" {
+				se, ok := status.FromError(err)
+				require.True(t, ok)
+				assert.Equal(t, tc.wantCode, se.Code)
+				assert.Equal(t, tc.wantMessage, se.Message)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantChoice, choice)
+		})
+	}
+
+	t.Run("handshake required", func(t *testing.T) {
+		conn, err := net.Dial("tcp", ":8086")
+		require.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		req, err := newRequest(context.Background(), json.Serializer{}, compress.DoNothingCompressor{},
+			"user-service", "GetById", []byte(`{"Id":123}`))
+		require.NoError(t, err)
+		require.NoError(t, tcp.WriteMsg(conn, message2.EncodeReq(req)))
+		bs, err := tcp.ReadMsg(conn)
+		require.NoError(t, err)
+		resp, err := message2.DecodeResp(bs)
+		require.NoError(t, err)
+		assert.Equal(t, message2.MessageTypeHandshake, resp.MessageType)
+		assert.Equal(t, status.New(status.FailedPrecondition, errs.HandshakeRequiredError.Error()), responseError(resp))
+	})
+
+	t.Run("client", func(t *testing.T) {
+		client, err := NewClient(":8086", ClientWithCompressor(gzip.Compressor{}))
+		require.NoError(t, err)
+		defer func() {
+			_ = client.Close()
+		}()
+		usClient := &UserServiceClient{}
+		require.NoError(t, client.InitService(usClient))
+		_, err = usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+		assert.ErrorContains(t, err, "emicro: handshake failed: the server does not support any compressor of [1]")
+	})
+}
@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// heartbeat -> detect the unresponsive peer of a connection
+// A ping is sent every interval, and the peer is considered dead
+// if no frame arrives within timeout after the ping.
+// Any frame proves that the peer is alive, not only the pong.
+// The zero value is ready to use.
+type heartbeat struct {
+	// unix nano of the last frame received
+	lastRead int64
+}
+
+// touch -> a frame is received
+func (h *heartbeat) touch() {
+	atomic.StoreInt64(&h.lastRead, time.Now().UnixNano())
+}
+
+// run -> blocks until done is closed, ping fails or dead is called
+func (h *heartbeat) run(interval, timeout time.Duration,
+	done <-chan struct{}, ping func() error, dead func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	deadCh := make(chan struct{})
+	// timers of the previous pings may still be running if timeout is longer than interval
+	var once sync.Once
+	for {
+		select {
+		case <-done:
+			return
+		case <-deadCh:
+			return
+		case <-ticker.C:
+		}
+		sent := time.Now().UnixNano()
+		// writing to a dead peer may block until the send buffer is full,
+		// so the timeout must be checked in another goroutine
+		timer := time.AfterFunc(timeout, func() {
+			if atomic.LoadInt64(&h.lastRead) < sent {
+				once.Do(func() {
+					dead()
+					close(deadCh)
+				})
+			}
+		})
+		if err := ping(); err != nil {
+			timer.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"emicro/rpc/compress"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/serialize/json"
+	"emicro/rpc/tcp"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientConn_keepalive(t *testing.T) {
+	testCases := []struct {
+		name string
+		// the fake server
+		serve func(conn net.Conn)
+
+		wantClosed bool
+	}{
+		{
+			name: "pong",
+			serve: func(conn net.Conn) {
+				for {
+					bs, err := tcp.ReadMsg(conn)
+					if err != nil {
+						return
+					}
+					if req, er := message2.DecodeReq(bs); er != nil || req.MessageType != message2.MessageTypePing {
+						continue
+					}
+					pong := &message2.Response{Version: message2.ProtocolVersion, MessageType: message2.MessageTypePong}
+					pong.CalculateHeaderLength()
+					_ = tcp.WriteMsg(conn, message2.EncodeResp(pong))
+				}
+			},
+		},
+		{
+			// the ping can not even be written
+			name:       "unresponsive",
+			serve:      func(conn net.Conn) {},
+			wantClosed: true,
+		},
+		{
+			name: "no pong",
+			serve: func(conn net.Conn) {
+				for {
+					if _, err := tcp.ReadMsg(conn); err != nil {
+						return
+					}
+				}
+			},
+			wantClosed: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer func() {
+				_ = server.Close()
+			}()
+			go tc.serve(server)
+			cc := newClientConn(client, tcp.DefaultMaxFrameSize)
+			defer func() {
+				_ = cc.Close()
+			}()
+			cc.keepalive(time.Millisecond*50, time.Millisecond*100)
+
+			time.Sleep(time.Millisecond * 500)
+			assert.Equal(t, tc.wantClosed, cc.closed())
+			if tc.wantClosed {
+				assert.Equal(t, errs.HeartbeatTimeoutError, cc.closeErr())
+			}
+		})
+	}
+}
+
+func TestClientConn_answerPing(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() {
+		_ = server.Close()
+	}()
+	cc := newClientConn(client, tcp.DefaultMaxFrameSize)
+	defer func() {
+		_ = cc.Close()
+	}()
+
+	ping := &message2.Response{Version: message2.ProtocolVersion, MessageType: message2.MessageTypePing}
+	ping.CalculateHeaderLength()
+	require.NoError(t, tcp.WriteMsg(server, message2.EncodeResp(ping)))
+	bs, err := tcp.ReadMsg(server)
+	require.NoError(t, err)
+	req, err := message2.DecodeReq(bs)
+	require.NoError(t, err)
+	assert.Equal(t, message2.MessageTypePong, req.MessageType)
+}
+
+func TestServer_Heartbeat(t *testing.T) {
+	server := NewServer(ServerWithIdleTimeout(time.Millisecond*300),
+		ServerWithHeartbeat(time.Millisecond*100, time.Millisecond*200))
+	_ = server.RegisterService(&UserServiceServer{Msg: "hello, world"})
+	go func() {
+		err := server.Start(":8084")
+		t.Log(err)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	time.Sleep(time.Second * 3)
+
+	t.Run("idle", func(t *testing.T) {
+		conn, err := net.Dial("tcp", ":8084")
+		require.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		_, err = clientHandshake(context.Background(), conn, &message2.Handshake{
+			Versions:    []uint8{message2.ProtocolVersion},
+			Serializers: []uint8{json.Serializer{}.Code()},
+			Compressors: []uint8{compress.DoNothingCompressor{}.Code()},
+		}, tcp.DefaultMaxFrameSize)
+		require.NoError(t, err)
+		start := time.Now()
+		// the pings of the server are never answered, and nothing is sent to the server
+		for {
+			_, err = tcp.ReadMsg(conn)
+			if err != nil {
+				break
+			}
+		}
+		assert.Equal(t, io.EOF, err)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("keepalive", func(t *testing.T) {
+		client, err := NewClient(":8084", ClientWithMaxConns(1),
+			ClientWithHeartbeat(time.Millisecond*100, time.Millisecond*200))
+		require.NoError(t, err)
+		defer func() {
+			_ = client.Close()
+		}()
+		usClient := &UserServiceClient{}
+		require.NoError(t, client.InitService(usClient))
+		_, err = usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+		require.NoError(t, err)
+		conn, err := client.connPool.Get(context.Background())
+		require.NoError(t, err)
+
+		// longer than the idle timeout
+		time.Sleep(time.Second)
+		assert.False(t, conn.closed())
+		resp, err := usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+		require.NoError(t, err)
+		assert.Equal(t, "hello, world", resp.Msg)
+	})
+}
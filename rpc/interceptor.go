@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"context"
+	message2 "emicro/rpc/message"
+)
+
+// UnaryInvoker -> sends the request to the server, it's what Proxy.Invoke does
+type UnaryInvoker func(ctx context.Context, req *message2.Request) (*message2.Response, error)
+
+// UnaryClientInterceptor -> intercept the unary call on the client side.
+// The interceptor is responsible for calling invoker to complete the call.
+type UnaryClientInterceptor func(ctx context.Context, req *message2.Request, invoker UnaryInvoker) (*message2.Response, error)
+
+// UnaryHandler -> handles the request, it's what Server.Invoke does
+type UnaryHandler func(ctx context.Context, req *message2.Request) *message2.Response
+
+// UnaryServerInterceptor -> intercept the unary call on the server side.
+// The interceptor is responsible for calling handler to complete the call.
+type UnaryServerInterceptor func(ctx context.Context, req *message2.Request, handler UnaryHandler) *message2.Response
+
+// NewErrorResponse -> the response failing req with err,
+// a server interceptor returns it to reject the request without calling the handler.
+// *status.Error keeps its code and details, the other errors are sent as business errors.
+func NewErrorResponse(req *message2.Request, err error) *message2.Response {
+	resp := &message2.Response{
+		Version:    req.Version,
+		Compresser: req.Compresser,
+		Serializer: req.Serializer,
+		MessageId:  req.MessageId,
+	}
+	setResponseError(resp, err)
+	return resp
+}
+
+// chainUnaryClientInterceptors -> the first interceptor is the outermost one
+func chainUnaryClientInterceptors(interceptors []UnaryClientInterceptor, invoker UnaryInvoker) UnaryInvoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, req *message2.Request) (*message2.Response, error) {
+			return interceptor(ctx, req, next)
+		}
+	}
+	return invoker
+}
+
+// chainUnaryServerInterceptors -> the first interceptor is the outermost one
+func chainUnaryServerInterceptors(interceptors []UnaryServerInterceptor, handler UnaryHandler) UnaryHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req *message2.Request) *message2.Response {
+			return interceptor(ctx, req, next)
+		}
+	}
+	return handler
+}
@@ -0,0 +1,103 @@
+package rpc
+
+import (
+	"context"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/status"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainUnaryClientInterceptors(t *testing.T) {
+	var records []string
+	newInterceptor := func(name string) UnaryClientInterceptor {
+		return func(ctx context.Context, req *message2.Request, invoker UnaryInvoker) (*message2.Response, error) {
+			records = append(records, name+" before")
+			resp, err := invoker(ctx, req)
+			records = append(records, name+" after")
+			return resp, err
+		}
+	}
+	invoker := chainUnaryClientInterceptors([]UnaryClientInterceptor{
+		newInterceptor("first"), newInterceptor("second"),
+	}, func(ctx context.Context, req *message2.Request) (*message2.Response, error) {
+		records = append(records, "invoker")
+		return &message2.Response{MessageId: req.MessageId}, nil
+	})
+	resp, err := invoker(context.Background(), &message2.Request{MessageId: 12})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(12), resp.MessageId)
+	assert.Equal(t, []string{"first before", "second before", "invoker", "second after", "first after"}, records)
+}
+
+func TestServer_InvokeWithInterceptors(t *testing.T) {
+	var records []string
+	recorder := func(ctx context.Context, req *message2.Request, handler UnaryHandler) *message2.Response {
+		records = append(records, "recorder "+req.MethodName)
+		return handler(ctx, req)
+	}
+	auth := func(ctx context.Context, req *message2.Request, handler UnaryHandler) *message2.Response {
+		if req.Meta["token"] != "123" {
+			return NewErrorResponse(req, status.New(status.Unauthenticated, "invalid token").WithDetails([]byte("token")))
+		}
+		return handler(ctx, req)
+	}
+	server := NewServer(ServerWithInterceptors(recorder), ServerWithInterceptors(auth))
+	err := server.RegisterService(&UserService{})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		meta     map[string]string
+		wantResp *message2.Response
+	}{
+		{
+			name: "rejected",
+			wantResp: &message2.Response{
+				MessageId:    1,
+				Serializer:   1,
+				Code:         uint16(status.Unauthenticated),
+				Error:        []byte("invalid token"),
+				ErrorDetails: []byte("token"),
+			},
+		},
+		{
+			name: "passed",
+			meta: map[string]string{"token": "123"},
+			wantResp: &message2.Response{
+				MessageId:  1,
+				Serializer: 1,
+				Data:       []byte(`{"msg":"这是GetById的响应"}`),
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			records = nil
+			resp := server.Invoke(context.Background(), &message2.Request{
+				MessageId:   1,
+				Serializer:  1,
+				ServiceName: "user-service",
+				MethodName:  "GetById",
+				Meta:        tc.meta,
+				Data:        []byte(`{}`),
+			})
+			assert.Equal(t, tc.wantResp, resp)
+			assert.Equal(t, []string{"recorder GetById"}, records)
+		})
+	}
+}
+
+func TestClientWithInterceptors(t *testing.T) {
+	// the interceptor can short-circuit the call without any connection
+	client, err := NewClient(":0", ClientWithInterceptors(
+		func(ctx context.Context, req *message2.Request, invoker UnaryInvoker) (*message2.Response, error) {
+			return nil, errors.New("mock error")
+		}))
+	require.NoError(t, err)
+	_, err = client.Invoke(context.Background(), &message2.Request{})
+	assert.Equal(t, errors.New("mock error"), err)
+}
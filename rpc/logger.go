@@ -0,0 +1,18 @@
+package rpc
+
+import "log"
+
+// Logger -> the server reports the errors which can not be returned to the clients,
+// e.g. the failed writes and the panics of the service methods with their stack traces
+type Logger interface {
+	Errorf(format string, args ...any)
+}
+
+var _ Logger = stdLogger{}
+
+// stdLogger -> the default logger, writes to the standard logger of the log package
+type stdLogger struct{}
+
+func (_ stdLogger) Errorf(format string, args ...any) {
+	log.Printf(format, args...)
+}
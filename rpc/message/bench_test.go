@@ -0,0 +1,107 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBenchReq() *Request {
+	req := &Request{
+		MessageId:   123,
+		Version:     1,
+		Compresser:  1,
+		Serializer:  1,
+		ServiceName: "user-service",
+		MethodName:  "GetById",
+		Meta: map[string]string{
+			"trace-id": "123456",
+		},
+		Data: make([]byte, 256),
+	}
+	req.CalculateHeaderLength()
+	req.CalculateBodyLength()
+	return req
+}
+
+// internNames 模拟服务端，返回已经注册的名字
+func internNames(names ...string) func(b []byte) string {
+	m := make(map[string]string, len(names))
+	for _, name := range names {
+		m[name] = name
+	}
+	return func(b []byte) string {
+		if name, ok := m[string(b)]; ok {
+			return name
+		}
+		return string(b)
+	}
+}
+
+func TestDecodeReqWith(t *testing.T) {
+	req := newBenchReq()
+	req.Meta = nil
+	req.CalculateHeaderLength()
+	bs := EncodeReq(req)
+	intern := internNames("user-service", "GetById")
+
+	got, err := DecodeReqWith(bs, intern)
+	require.NoError(t, err)
+	assert.Equal(t, req, got)
+	// 只有 Request 本身需要分配内存
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = DecodeReqWith(bs, intern)
+	})
+	assert.LessOrEqual(t, allocs, float64(1))
+}
+
+func BenchmarkEncodeReq(b *testing.B) {
+	req := newBenchReq()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = EncodeReq(req)
+	}
+}
+
+func BenchmarkAppendReqHeader(b *testing.B) {
+	req := newBenchReq()
+	buf := make([]byte, 0, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = AppendReqHeader(buf[:0], req)
+	}
+}
+
+func BenchmarkDecodeReq(b *testing.B) {
+	bs := EncodeReq(newBenchReq())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = DecodeReq(bs)
+	}
+}
+
+func BenchmarkDecodeReqWith(b *testing.B) {
+	bs := EncodeReq(newBenchReq())
+	intern := internNames("user-service", "GetById", "trace-id")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = DecodeReqWith(bs, intern)
+	}
+}
+
+func BenchmarkEncodeResp(b *testing.B) {
+	resp := &Response{
+		MessageId:  123,
+		Version:    1,
+		Compresser: 1,
+		Serializer: 1,
+		Data:       make([]byte, 256),
+	}
+	resp.CalculateHeaderLength()
+	resp.CalculateBodyLength()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = EncodeResp(resp)
+	}
+}
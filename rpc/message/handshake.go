@@ -0,0 +1,50 @@
+package message
+
+import (
+	"emicro/internal/errs"
+)
+
+// ProtocolVersion 当前协议版本，也就是现在的头部布局
+// 修改头部布局时需要增加版本号，并在服务端保留旧版本的支持，滚动发布时新旧客户端都能连上
+const ProtocolVersion uint8 = 1
+
+// Handshake 连接建立后客户端发送的第一个帧的数据部分
+// 客户端按照偏好顺序列出支持的协议版本、序列化协议和压缩算法，
+// 服务端回复同样的结构，每一项只有一个元素，就是服务端的选择。
+// 握手帧本身总是使用版本 1 的头部布局，这个布局永远不会改变。
+type Handshake struct {
+	Versions    []uint8
+	Serializers []uint8
+	Compressors []uint8
+}
+
+// EncodeHandshake 每一项都是一个字节的长度加上对应数量的字节
+func EncodeHandshake(h *Handshake) []byte {
+	bs := make([]byte, 0, 3+len(h.Versions)+len(h.Serializers)+len(h.Compressors))
+	for _, item := range [][]uint8{h.Versions, h.Serializers, h.Compressors} {
+		bs = append(bs, uint8(len(item)))
+		bs = append(bs, item...)
+	}
+	return bs
+}
+
+func DecodeHandshake(bs []byte) (*Handshake, error) {
+	items := make([][]uint8, 0, 3)
+	for i := 0; i < 3; i++ {
+		if len(bs) == 0 {
+			return nil, errs.InvalidHandshakeError
+		}
+		n := int(bs[0])
+		bs = bs[1:]
+		if len(bs) < n {
+			return nil, errs.InvalidHandshakeError
+		}
+		items = append(items, bs[:n])
+		bs = bs[n:]
+	}
+	return &Handshake{
+		Versions:    items[0],
+		Serializers: items[1],
+		Compressors: items[2],
+	}, nil
+}
@@ -0,0 +1,65 @@
+package message
+
+import (
+	"emicro/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEncodeDecodeHandshake(t *testing.T) {
+	testCases := []struct {
+		name string
+		h    *Handshake
+	}{
+		{
+			name: "offer",
+			h: &Handshake{
+				Versions:    []uint8{2, 1},
+				Serializers: []uint8{1, 2},
+				Compressors: []uint8{1, 0},
+			},
+		},
+		{
+			name: "choice",
+			h: &Handshake{
+				Versions:    []uint8{1},
+				Serializers: []uint8{1},
+				Compressors: []uint8{0},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := DecodeHandshake(EncodeHandshake(tc.h))
+			require.NoError(t, err)
+			assert.Equal(t, tc.h, h)
+		})
+	}
+}
+
+func TestDecodeHandshake_Invalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		bs   []byte
+	}{
+		{
+			name: "empty",
+			bs:   nil,
+		},
+		{
+			name: "truncated",
+			bs:   []byte{2, 1},
+		},
+		{
+			name: "missing compressors",
+			bs:   []byte{1, 1, 1, 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DecodeHandshake(tc.bs)
+			assert.Equal(t, errs.InvalidHandshakeError, err)
+		})
+	}
+}
@@ -2,7 +2,9 @@ package message
 
 import (
 	"bytes"
+	"emicro/internal/errs"
 	"encoding/binary"
+	"fmt"
 )
 
 const (
@@ -10,6 +12,15 @@ const (
 	pairSplitter = '\r'
 )
 
+const (
+	// fixedReqHeaderLength 固定头部：长度、消息 ID 和四个单字节字段
+	fixedReqHeaderLength = 16
+	// MaxHeadLength 头部的最大长度，包括服务名、方法名和 meta
+	MaxHeadLength = 64 << 10
+	// MaxMetaEntries meta 键值对的最大数量
+	MaxMetaEntries = 128
+)
+
 // Request ->
 type Request struct {
 	// 头部
@@ -25,6 +36,8 @@ type Request struct {
 	Compresser uint8
 	// 序列化协议
 	Serializer uint8
+	// 消息类型
+	MessageType uint8
 
 	// 服务名和方法名
 	ServiceName string
@@ -38,52 +51,66 @@ type Request struct {
 }
 
 func EncodeReq(req *Request) []byte {
-	bs := make([]byte, req.HeadLength+req.BodyLength)
+	bs := make([]byte, 0, req.HeadLength+req.BodyLength)
+	bs = AppendReqHeader(bs, req)
+	return append(bs, req.Data...)
+}
+
+// AppendReqHeader 把请求头部追加到 dst 后面，不包括请求数据
+// 调用方可以复用 dst，并且把头部和数据分开写入连接，避免拼接整个帧
+func AppendReqHeader(dst []byte, req *Request) []byte {
 	// 1. 写入 HeadLength，四个字节
-	binary.BigEndian.PutUint32(bs[:4], req.HeadLength)
+	dst = binary.BigEndian.AppendUint32(dst, req.HeadLength)
 	// 2. 写入 BodyLength 四个字节
-	binary.BigEndian.PutUint32(bs[4:8], req.BodyLength)
+	dst = binary.BigEndian.AppendUint32(dst, req.BodyLength)
 	// 3. 写入 message id, 四个字节
-	binary.BigEndian.PutUint32(bs[8:12], req.MessageId)
-
+	dst = binary.BigEndian.AppendUint32(dst, req.MessageId)
 	// 4. 写入 version，因为本身就是一个字节，所以不用进行编码了
-	bs[12] = req.Version
 	// 5. 写入压缩算法
-	bs[13] = req.Compresser
 	// 6. 写入序列化协议
-	bs[14] = req.Serializer
-
-	cur := bs[15:]
-	copy(cur, req.ServiceName)
-	cur = cur[len(req.ServiceName):]
-	cur[0] = splitter
-	cur = cur[1:]
-	copy(cur, req.MethodName)
-	cur = cur[len(req.MethodName):]
-	cur[0] = splitter
-	cur = cur[1:]
+	// 7. 写入消息类型
+	dst = append(dst, req.Version, req.Compresser, req.Serializer, req.MessageType)
+
+	dst = append(dst, req.ServiceName...)
+	dst = append(dst, splitter)
+	dst = append(dst, req.MethodName...)
+	dst = append(dst, splitter)
 
 	for key, value := range req.Meta {
-		copy(cur, key)
-		cur = cur[len(key):]
-		cur[0] = pairSplitter
-		cur = cur[1:]
-		copy(cur, value)
-		cur = cur[len(value):]
-		cur[0] = splitter
-		cur = cur[1:]
+		dst = append(dst, key...)
+		dst = append(dst, pairSplitter)
+		dst = append(dst, value...)
+		dst = append(dst, splitter)
 	}
-	copy(cur, req.Data)
-	return bs
+	return dst
 }
 
-func DecodeReq(bs []byte) *Request {
+// DecodeReq 解析请求，frame 来自对端，不能信任里面的任何长度字段
+// 帧被截断、分隔符缺失、长度不一致或者超过限制都会返回 errs.MalformedFrameError
+func DecodeReq(bs []byte) (*Request, error) {
+	return DecodeReqWith(bs, nil)
+}
+
+// DecodeReqWith 和 DecodeReq 一样，服务名、方法名和 meta 的 key 通过 intern 转换成字符串，
+// 比如服务端返回已经注册的名字，这样每个请求就不需要为它们分配内存。intern 为 nil 时直接转换。
+func DecodeReqWith(bs []byte, intern func(b []byte) string) (*Request, error) {
+	if intern == nil {
+		intern = func(b []byte) string {
+			return string(b)
+		}
+	}
+	if len(bs) < fixedReqHeaderLength {
+		return nil, errs.MalformedFrame("request is shorter than the fixed header")
+	}
 	req := &Request{}
 	// 按照 EncodeReq 写下来
 	// 1. 读取 HeadLength
 	req.HeadLength = binary.BigEndian.Uint32(bs[:4])
 	// 2. 读取 BodyLength
 	req.BodyLength = binary.BigEndian.Uint32(bs[4:8])
+	if err := checkLength(req.HeadLength, req.BodyLength, fixedReqHeaderLength, len(bs)); err != nil {
+		return nil, err
+	}
 	// 3. 读取 message id
 	req.MessageId = binary.BigEndian.Uint32(bs[8:12])
 	// 4. 读取 Version
@@ -92,48 +119,94 @@ func DecodeReq(bs []byte) *Request {
 	req.Compresser = bs[13]
 	// 6. 读取序列化协议
 	req.Serializer = bs[14]
+	// 7. 读取消息类型
+	req.MessageType = bs[15]
 	// 是头部剩余数据
-	header := bs[15:req.HeadLength]
-	// 7. 拆解服务名和方法名
+	header := bs[fixedReqHeaderLength:req.HeadLength]
+	// 8. 拆解服务名和方法名
 	index := bytes.IndexByte(header, splitter)
-	req.ServiceName = string(header[:index])
+	if index == -1 {
+		return nil, errs.MalformedFrame("missing the splitter after service name")
+	}
+	req.ServiceName = intern(header[:index])
 	// 加1 是为了跳掉分隔符
 	header = header[index+1:]
 
 	index = bytes.IndexByte(header, splitter)
+	if index == -1 {
+		return nil, errs.MalformedFrame("missing the splitter after method name")
+	}
 	// 拆解方法名
-	req.MethodName = string(header[:index])
+	req.MethodName = intern(header[:index])
 	// 加1 是为了跳掉分隔符
 	header = header[index+1:]
-	index = bytes.IndexByte(header, splitter)
-	if len(header) > 0 || index != -1 {
-		meta := make(map[string]string, 4)
-		// 切出来了
-		for index != -1 {
+	// 9. 剩下的都是 meta，每一个键值对都以 \n 结尾
+	if len(header) > 0 {
+		if header[len(header)-1] != splitter {
+			return nil, errs.MalformedFrame("meta is not terminated")
+		}
+		cnt := bytes.Count(header, []byte{splitter})
+		if cnt > MaxMetaEntries {
+			return nil, errs.MalformedFrame(fmt.Sprintf("%d meta entries exceed the limit of %d", cnt, MaxMetaEntries))
+		}
+		meta := make(map[string]string, cnt)
+		for len(header) > 0 {
+			index = bytes.IndexByte(header, splitter)
 			// 一个键值对
 			pair := header[:index]
 			// 切分 key-value
 			// 我们使用 \r 来切分键值对
 			pairIndex := bytes.IndexByte(pair, pairSplitter)
-			key := string(pair[:pairIndex])
+			if pairIndex == -1 {
+				return nil, errs.MalformedFrame("missing the splitter in meta pair")
+			}
+			key := intern(pair[:pairIndex])
 			// +1 也是为了跳掉分隔符
 			value := string(pair[pairIndex+1:])
 			meta[key] = value
 			// 往前移动 +1 跳掉分隔符
 			header = header[index+1:]
-			index = bytes.IndexByte(header, splitter)
 		}
+		req.Meta = meta
 	}
-	// 9. 读取协议请求体数据
+	// 10. 读取协议请求体数据
 	if req.BodyLength != 0 {
 		req.Data = bs[req.HeadLength:]
 	}
-	return req
+	return req, nil
+}
+
+// checkLength 头部长度不能小于固定部分，也不能超过 MaxHeadLength，
+// 头部长度加上消息体长度必须刚好是整个帧的长度
+func checkLength(headLength, bodyLength uint32, fixedLength int, frameLength int) error {
+	if headLength < uint32(fixedLength) {
+		return errs.MalformedFrame(fmt.Sprintf("head length %d is shorter than the fixed header", headLength))
+	}
+	if headLength > MaxHeadLength {
+		return errs.MalformedFrame(fmt.Sprintf("head length %d exceeds the limit of %d", headLength, MaxHeadLength))
+	}
+	if uint64(headLength)+uint64(bodyLength) != uint64(frameLength) {
+		return errs.MalformedFrame(fmt.Sprintf("head length %d and body length %d don't match the frame length %d",
+			headLength, bodyLength, frameLength))
+	}
+	return nil
+}
+
+// CheckLimits 编码前检查 meta 的数量和头部长度，HeadLength 必须已经计算好。
+// 对端解码时会把超过限制的请求当作畸形的帧并断开连接
+func (req *Request) CheckLimits() error {
+	if len(req.Meta) > MaxMetaEntries {
+		return errs.RequestTooLarge(fmt.Sprintf("%d meta entries exceed the limit of %d", len(req.Meta), MaxMetaEntries))
+	}
+	if req.HeadLength > MaxHeadLength {
+		return errs.RequestTooLarge(fmt.Sprintf("head length %d exceeds the limit of %d", req.HeadLength, MaxHeadLength))
+	}
+	return nil
 }
 
 func (req *Request) CalculateHeaderLength() {
 	// 不要忘了分隔符
-	headLength := 15 + len(req.ServiceName) + 1 + len(req.MethodName) + 1
+	headLength := fixedReqHeaderLength + len(req.ServiceName) + 1 + len(req.MethodName) + 1
 	for key, value := range req.Meta {
 		headLength += len(key)
 		// key 和 value 之间的分隔符
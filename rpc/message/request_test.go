@@ -1,7 +1,12 @@
 package message
 
 import (
+	"emicro/internal/errs"
+	"encoding/binary"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -66,6 +71,18 @@ func TestEncodeDecode(t *testing.T) {
 			},
 		},
 
+		{
+			name: "stream data",
+			req: &Request{
+				MessageId:   123,
+				Version:     12,
+				Compresser:  13,
+				Serializer:  14,
+				MessageType: MessageTypeStreamData,
+				Data:        []byte("hello, world"),
+			},
+		},
+
 		{
 			name: "no meta with data",
 			req: &Request{
@@ -85,8 +102,85 @@ func TestEncodeDecode(t *testing.T) {
 			tc.req.CalculateHeaderLength()
 			tc.req.CalculateBodyLength()
 			data := EncodeReq(tc.req)
-			req := DecodeReq(data)
+			req, err := DecodeReq(data)
+			require.NoError(t, err)
 			assert.Equal(t, tc.req, req)
 		})
 	}
 }
+
+func TestDecodeReqMalformed(t *testing.T) {
+	valid := &Request{ServiceName: "user-service", MethodName: "GetById", Meta: map[string]string{"a": "b"}, Data: []byte("hello")}
+	valid.CalculateHeaderLength()
+	valid.CalculateBodyLength()
+	// frame -> a frame with the fixed header and the given variable header, no body
+	frame := func(header string) []byte {
+		bs := make([]byte, 16+len(header))
+		binary.BigEndian.PutUint32(bs[:4], uint32(len(bs)))
+		copy(bs[16:], header)
+		return bs
+	}
+	tooManyMeta := "user-service\nGetById\n" + strings.Repeat("a\rb\n", MaxMetaEntries+1)
+	testCases := []struct {
+		name string
+		bs   []byte
+	}{
+		{name: "empty"},
+		{name: "truncated header", bs: EncodeReq(valid)[:10]},
+		{name: "truncated body", bs: EncodeReq(valid)[:valid.HeadLength+2]},
+		{name: "head length larger than frame", bs: func() []byte {
+			bs := EncodeReq(valid)
+			binary.BigEndian.PutUint32(bs[:4], uint32(len(bs)+1))
+			return bs
+		}()},
+		{name: "head length shorter than fixed header", bs: func() []byte {
+			bs := EncodeReq(valid)
+			binary.BigEndian.PutUint32(bs[:4], 3)
+			return bs
+		}()},
+		{name: "head length too large", bs: frame(strings.Repeat("a", MaxHeadLength) + "\n\n")},
+		{name: "missing service splitter", bs: frame("user-service")},
+		{name: "missing method splitter", bs: frame("user-service\nGetById")},
+		{name: "missing pair splitter", bs: frame("user-service\nGetById\nab\n")},
+		{name: "meta not terminated", bs: frame("user-service\nGetById\na\rb")},
+		{name: "too many meta", bs: frame(tooManyMeta)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DecodeReq(tc.bs)
+			assert.ErrorIs(t, err, errs.MalformedFrameError)
+		})
+	}
+}
+
+func TestRequest_CheckLimits(t *testing.T) {
+	meta := func(n int) map[string]string {
+		m := make(map[string]string, n)
+		for i := 0; i < n; i++ {
+			m[strconv.Itoa(i)] = "v"
+		}
+		return m
+	}
+	testCases := []struct {
+		name    string
+		req     *Request
+		wantErr bool
+	}{
+		{name: "ok", req: &Request{ServiceName: "user-service", MethodName: "GetById", Meta: meta(MaxMetaEntries)}},
+		{name: "too many meta", req: &Request{ServiceName: "user-service", MethodName: "GetById", Meta: meta(MaxMetaEntries + 1)}, wantErr: true},
+		{name: "head length too large", req: &Request{ServiceName: strings.Repeat("a", MaxHeadLength), MethodName: "GetById"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.req.CalculateHeaderLength()
+			err := tc.req.CheckLimits()
+			assert.Equal(t, tc.wantErr, err != nil)
+			if err == nil {
+				// the requests within the limits can be decoded by the peer
+				tc.req.CalculateBodyLength()
+				_, err = DecodeReq(EncodeReq(tc.req))
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package message
 
-import "encoding/binary"
+import (
+	"emicro/internal/errs"
+	"encoding/binary"
+	"fmt"
+)
 
 // Response ->
 type Response struct {
@@ -16,47 +20,68 @@ type Response struct {
 	Compresser uint8
 	// 序列化协议
 	Serializer uint8
-	// 错误
+	// 消息类型
+	MessageType uint8
+	// 状态码，非 0 代表框架错误，取值和 status.Code 一致
+	Code uint16
+	// 框架错误信息
 	Error []byte
-	// 你要区分业务 error 还是非业务 error
-	// BizError []byte // 代表的是业务返回的 error
+	// 框架错误详情，可选
+	ErrorDetails []byte
+	// 业务返回的 error，和框架错误区分开来
+	BizError []byte
 	// 协议 响应体 / 响应数据
 	Data []byte
 }
 
+// fixedRespHeaderLength 固定头部：16 字节的公共部分 + 2 字节状态码 + 两个 4 字节的长度字段
+const fixedRespHeaderLength = 26
+
 func EncodeResp(resp *Response) []byte {
-	bs := make([]byte, resp.HeadLength+resp.BodyLength)
+	bs := make([]byte, 0, resp.HeadLength+resp.BodyLength)
+	bs = AppendRespHeader(bs, resp)
+	return append(bs, resp.Data...)
+}
+
+// AppendRespHeader 把响应头部追加到 dst 后面，不包括响应数据，参考 AppendReqHeader
+func AppendRespHeader(dst []byte, resp *Response) []byte {
 	// 1. 写入 HeadLength，四个字节
-	binary.BigEndian.PutUint32(bs[:4], resp.HeadLength)
+	dst = binary.BigEndian.AppendUint32(dst, resp.HeadLength)
 	// 2. 写入 BodyLength 四个字节
-	binary.BigEndian.PutUint32(bs[4:8], resp.BodyLength)
+	dst = binary.BigEndian.AppendUint32(dst, resp.BodyLength)
 	// 3. 写入 message id, 四个字节
-	binary.BigEndian.PutUint32(bs[8:12], resp.MessageId)
-
+	dst = binary.BigEndian.AppendUint32(dst, resp.MessageId)
 	// 4. 写入 version，因为本身就是一个字节，所以不用进行编码了
-	bs[12] = resp.Version
 	// 5. 写入压缩算法
-	bs[13] = resp.Compresser
 	// 6. 写入序列化协议
-	bs[14] = resp.Serializer
+	// 7. 写入消息类型
+	dst = append(dst, resp.Version, resp.Compresser, resp.Serializer, resp.MessageType)
 
-	// 7. 写入 error, 写入 Eorror 后不 +1 -> (cur[len(resp.Error)+1:]) 是因为
-	// 直接取头部长度就区分了 head 和 body ， 而 Error 的前一个参数 Serializer 也刚好为 1 字节
-	cur := bs[15:]
-	copy(cur, resp.Error)
-	cur = cur[len(resp.Error):]
+	// 8. 写入状态码，两个字节
+	dst = binary.BigEndian.AppendUint16(dst, resp.Code)
+	// 9. 写入 Error 和 ErrorDetails 的长度，BizError 的长度可以通过头部长度算出来
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(resp.Error)))
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(resp.ErrorDetails)))
 
-	// 8. 剩下的数据
-	copy(cur, resp.Data)
-	return bs
+	// 10. 依次写入 Error、ErrorDetails、BizError
+	dst = append(dst, resp.Error...)
+	dst = append(dst, resp.ErrorDetails...)
+	return append(dst, resp.BizError...)
 }
 
-func DecodeResp(bs []byte) *Response {
+// DecodeResp 解析响应，和 DecodeReq 一样校验所有的长度字段
+func DecodeResp(bs []byte) (*Response, error) {
+	if len(bs) < fixedRespHeaderLength {
+		return nil, errs.MalformedFrame("response is shorter than the fixed header")
+	}
 	resp := &Response{}
 	// 1. 读取 HeadLength
 	resp.HeadLength = binary.BigEndian.Uint32(bs[:4])
 	// 2. 读取 BodyLength
 	resp.BodyLength = binary.BigEndian.Uint32(bs[4:8])
+	if err := checkLength(resp.HeadLength, resp.BodyLength, fixedRespHeaderLength, len(bs)); err != nil {
+		return nil, err
+	}
 	// 3. 读取 message id
 	resp.MessageId = binary.BigEndian.Uint32(bs[8:12])
 
@@ -66,17 +91,43 @@ func DecodeResp(bs []byte) *Response {
 	resp.Compresser = bs[13]
 	// 6. 读取序列化协议
 	resp.Serializer = bs[14]
+	// 7. 读取消息类型
+	resp.MessageType = bs[15]
+
+	// 8. 读取状态码
+	resp.Code = binary.BigEndian.Uint16(bs[16:18])
+	// 9. 读取 Error 和 ErrorDetails 的长度
+	errLength := binary.BigEndian.Uint32(bs[18:22])
+	detailsLength := binary.BigEndian.Uint32(bs[22:26])
 
-	// 7. error 信息
-	resp.Error = bs[15:resp.HeadLength]
+	// 10. 切分 Error、ErrorDetails、BizError
+	header := bs[fixedRespHeaderLength:resp.HeadLength]
+	if uint64(errLength)+uint64(detailsLength) > uint64(len(header)) {
+		return nil, errs.MalformedFrame(fmt.Sprintf("error length %d and details length %d exceed the header",
+			errLength, detailsLength))
+	}
+	if errLength > 0 {
+		resp.Error = header[:errLength]
+	}
+	header = header[errLength:]
+	if detailsLength > 0 {
+		resp.ErrorDetails = header[:detailsLength]
+	}
+	header = header[detailsLength:]
+	if len(header) > 0 {
+		resp.BizError = header
+	}
 
 	// 剩下的就是数据了
-	resp.Data = bs[resp.HeadLength:]
-	return resp
+	if resp.BodyLength != 0 {
+		resp.Data = bs[resp.HeadLength:]
+	}
+	return resp, nil
 }
 
 func (resp *Response) CalculateHeaderLength() {
-	resp.HeadLength = 15 + uint32(len(resp.Error))
+	resp.HeadLength = fixedRespHeaderLength + uint32(len(resp.Error)) +
+		uint32(len(resp.ErrorDetails)) + uint32(len(resp.BizError))
 }
 
 func (resp *Response) CalculateBodyLength() {
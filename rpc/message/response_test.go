@@ -1,7 +1,10 @@
 package message
 
 import (
+	"emicro/internal/errs"
+	"encoding/binary"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 )
 
@@ -42,6 +45,52 @@ func TestRespEncodeDecode(t *testing.T) {
 			},
 		},
 
+		{
+			name: "status error",
+			resp: &Response{
+				MessageId:    123,
+				Version:      12,
+				Compresser:   13,
+				Serializer:   14,
+				Code:         5,
+				Error:        []byte("this is error"),
+				ErrorDetails: []byte("details"),
+				Data:         []byte("hello, world"),
+			},
+		},
+		{
+			name: "biz error",
+			resp: &Response{
+				MessageId:  123,
+				Version:    12,
+				Compresser: 13,
+				Serializer: 14,
+				BizError:   []byte("this is biz error"),
+				Data:       []byte("hello, world"),
+			},
+		},
+		{
+			name: "all errors",
+			resp: &Response{
+				MessageId:    123,
+				Code:         13,
+				Error:        []byte("this is error"),
+				ErrorDetails: []byte("details"),
+				BizError:     []byte("this is biz error"),
+			},
+		},
+		{
+			name: "stream half close",
+			resp: &Response{
+				MessageId:   123,
+				Version:     12,
+				Compresser:  13,
+				Serializer:  14,
+				MessageType: MessageTypeStreamHalfClose,
+				Error:       []byte("this is error"),
+			},
+		},
+
 		//{
 		//	name: "data with \n ",
 		//	resp: &Response{
@@ -60,8 +109,50 @@ func TestRespEncodeDecode(t *testing.T) {
 			tc.resp.CalculateHeaderLength()
 			tc.resp.CalculateBodyLength()
 			data := EncodeResp(tc.resp)
-			req := DecodeResp(data)
-			assert.Equal(t, tc.resp, req)
+			resp, err := DecodeResp(data)
+			require.NoError(t, err)
+			assert.Equal(t, tc.resp, resp)
+		})
+	}
+}
+
+func TestDecodeRespMalformed(t *testing.T) {
+	valid := &Response{Error: []byte("error"), BizError: []byte("biz"), Data: []byte("hello")}
+	valid.CalculateHeaderLength()
+	valid.CalculateBodyLength()
+	testCases := []struct {
+		name string
+		bs   []byte
+	}{
+		{name: "empty"},
+		{name: "truncated header", bs: EncodeResp(valid)[:20]},
+		{name: "truncated body", bs: EncodeResp(valid)[:valid.HeadLength+2]},
+		{name: "head length larger than frame", bs: func() []byte {
+			bs := EncodeResp(valid)
+			binary.BigEndian.PutUint32(bs[:4], uint32(len(bs)+1))
+			return bs
+		}()},
+		{name: "head length shorter than fixed header", bs: func() []byte {
+			bs := EncodeResp(valid)
+			binary.BigEndian.PutUint32(bs[:4], 16)
+			return bs
+		}()},
+		{name: "error length larger than header", bs: func() []byte {
+			bs := EncodeResp(valid)
+			binary.BigEndian.PutUint32(bs[18:22], 100)
+			return bs
+		}()},
+		{name: "lengths overflow", bs: func() []byte {
+			bs := EncodeResp(valid)
+			binary.BigEndian.PutUint32(bs[18:22], 1<<32-1)
+			binary.BigEndian.PutUint32(bs[22:26], 2)
+			return bs
+		}()},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DecodeResp(tc.bs)
+			assert.ErrorIs(t, err, errs.MalformedFrameError)
 		})
 	}
 }
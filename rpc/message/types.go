@@ -0,0 +1,35 @@
+package message
+
+// 消息类型，一个字节，用于区分普通调用和流式调用的各种帧
+const (
+	// MessageTypeUnary 普通的一元调用，也是默认值
+	MessageTypeUnary uint8 = iota
+	// MessageTypeStreamOpen 打开一个流，MessageId 就是流的 ID
+	MessageTypeStreamOpen
+	// MessageTypeStreamData 流上的一条消息
+	MessageTypeStreamData
+	// MessageTypeStreamHalfClose 发送方不会再发送消息了
+	// 服务端发送的 half-close 同时携带调用的错误，代表流结束
+	MessageTypeStreamHalfClose
+	// MessageTypeStreamReset 异常终止流
+	MessageTypeStreamReset
+	// MessageTypeStreamWindowUpdate 接收方消费了消息，归还发送方可以继续发送的消息数量
+	// 数据部分是四个字节的大端整数，见 EncodeWindowUpdate
+	MessageTypeStreamWindowUpdate
+	// MessageTypeGoAway 服务端即将关闭，客户端不要在这个连接上发送新的调用
+	MessageTypeGoAway
+	// MessageTypePing 心跳，两端都可以发送，对端必须回复 pong
+	MessageTypePing
+	// MessageTypePong 心跳的回复
+	MessageTypePong
+	// MessageTypeHandshake 握手，连接上的第一个帧，协商协议版本、序列化协议和压缩算法
+	MessageTypeHandshake
+	// MessageTypeCancel 客户端放弃了 MessageId 对应的一元调用，服务端取消传给方法的 context
+	// 不认识这个类型的旧服务端会把它当成找不到服务的调用，返回的错误会被客户端忽略
+	MessageTypeCancel
+)
+
+// IsStream 判断是否为流式调用的帧
+func IsStream(typ uint8) bool {
+	return typ >= MessageTypeStreamOpen && typ <= MessageTypeStreamWindowUpdate
+}
@@ -0,0 +1,20 @@
+package message
+
+import (
+	"emicro/internal/errs"
+	"encoding/binary"
+)
+
+// EncodeWindowUpdate 流控帧的数据部分，四个字节的大端整数，代表归还的消息数量
+func EncodeWindowUpdate(credits uint32) []byte {
+	bs := make([]byte, 4)
+	binary.BigEndian.PutUint32(bs, credits)
+	return bs
+}
+
+func DecodeWindowUpdate(bs []byte) (uint32, error) {
+	if len(bs) != 4 {
+		return 0, errs.InvalidWindowUpdate
+	}
+	return binary.BigEndian.Uint32(bs), nil
+}
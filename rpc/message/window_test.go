@@ -0,0 +1,17 @@
+package message
+
+import (
+	"emicro/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEncodeDecodeWindowUpdate(t *testing.T) {
+	credits, err := DecodeWindowUpdate(EncodeWindowUpdate(32))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(32), credits)
+
+	_, err = DecodeWindowUpdate([]byte{0, 32})
+	assert.Equal(t, errs.InvalidWindowUpdate, err)
+}
@@ -0,0 +1,126 @@
+// Package metadata -> the metadata carried by a rpc call, similar to grpc/metadata
+// The client copies the outgoing metadata into Request.Meta,
+// and the server exposes Request.Meta to the service methods as the incoming metadata.
+package metadata
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"fmt"
+	"strings"
+)
+
+// MD -> the metadata, keys are lowercase
+// Every key has only one value, because Request.Meta is a map[string]string.
+type MD map[string]string
+
+// New -> create MD from a map, the keys are converted to lowercase
+func New(m map[string]string) MD {
+	md := make(MD, len(m))
+	for k, v := range m {
+		md.Set(k, v)
+	}
+	return md
+}
+
+// Pairs -> create MD from key-value pairs, Pairs("tenant-id", "1", "caller", "order-service")
+// It panics if the number of kv is odd.
+func Pairs(kv ...string) MD {
+	if len(kv)%2 == 1 {
+		panic(fmt.Sprintf("metadata: Pairs got the odd number of input pairs for metadata: %d", len(kv)))
+	}
+	md := make(MD, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		md.Set(kv[i], kv[i+1])
+	}
+	return md
+}
+
+// Get -> the value of key, "" if it does not exist
+func (md MD) Get(key string) string {
+	return md[strings.ToLower(key)]
+}
+
+// Set -> set the value of key, the old value is replaced
+func (md MD) Set(key, value string) {
+	md[strings.ToLower(key)] = value
+}
+
+// Delete -> remove the key
+func (md MD) Delete(key string) {
+	delete(md, strings.ToLower(key))
+}
+
+// Len -> the number of keys
+func (md MD) Len() int {
+	return len(md)
+}
+
+// Copy -> a copy of md, changing it won't affect md
+func (md MD) Copy() MD {
+	res := make(MD, len(md))
+	for k, v := range md {
+		res[k] = v
+	}
+	return res
+}
+
+// Join -> merge all the mds into a new one, the latter one wins if a key is duplicated
+func Join(mds ...MD) MD {
+	res := MD{}
+	for _, md := range mds {
+		for k, v := range md {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+type outgoingKey struct{}
+
+type incomingKey struct{}
+
+// NewOutgoingContext -> attach md to ctx, the client sends it to the server.
+// It replaces the outgoing metadata already in ctx, use AppendToOutgoingContext to keep it.
+func NewOutgoingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, outgoingKey{}, md)
+}
+
+// AppendToOutgoingContext -> add the key-value pairs to the outgoing metadata in ctx
+// It panics if the number of kv is odd.
+func AppendToOutgoingContext(ctx context.Context, kv ...string) context.Context {
+	md, _ := FromOutgoingContext(ctx)
+	return NewOutgoingContext(ctx, Join(md, Pairs(kv...)))
+}
+
+// FromOutgoingContext -> the outgoing metadata in ctx
+// The returned md should not be modified, call Copy first.
+func FromOutgoingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(outgoingKey{}).(MD)
+	return md, ok
+}
+
+// NewIncomingContext -> attach the metadata received from the client to ctx,
+// it's used by the server, and the tests of the service methods.
+func NewIncomingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, incomingKey{}, md)
+}
+
+// FromIncomingContext -> the metadata received from the client
+// The returned md should not be modified, call Copy first.
+func FromIncomingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(incomingKey{}).(MD)
+	return md, ok
+}
+
+// Validate -> whether md can be encoded into Request.Meta
+// The key-value pairs are separated by '\n', and the key and value are separated by '\r',
+// so they can not appear in the metadata, and the key can not be empty.
+func Validate(md MD) error {
+	for k, v := range md {
+		if k == "" || strings.ContainsAny(k, "\r\n") || strings.ContainsAny(v, "\r\n") {
+			return errs.InvalidMetadata(k, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPairs(t *testing.T) {
+	md := Pairs("Tenant-Id", "1", "caller", "order-service")
+	assert.Equal(t, MD{"tenant-id": "1", "caller": "order-service"}, md)
+	assert.Equal(t, "1", md.Get("TENANT-ID"))
+	assert.Panics(t, func() {
+		Pairs("tenant-id")
+	})
+}
+
+func TestJoin(t *testing.T) {
+	md := Join(Pairs("a", "1", "b", "2"), nil, New(map[string]string{"B": "3"}))
+	assert.Equal(t, MD{"a": "1", "b": "3"}, md)
+}
+
+func TestOutgoingContext(t *testing.T) {
+	ctx := context.Background()
+	_, ok := FromOutgoingContext(ctx)
+	assert.False(t, ok)
+
+	ctx = NewOutgoingContext(ctx, Pairs("tenant-id", "1"))
+	appended := AppendToOutgoingContext(ctx, "trace-id", "abc", "tenant-id", "2")
+	md, ok := FromOutgoingContext(appended)
+	assert.True(t, ok)
+	assert.Equal(t, MD{"tenant-id": "2", "trace-id": "abc"}, md)
+	// the parent context is not changed
+	md, _ = FromOutgoingContext(ctx)
+	assert.Equal(t, MD{"tenant-id": "1"}, md)
+
+	// outgoing metadata is not incoming metadata
+	_, ok = FromIncomingContext(ctx)
+	assert.False(t, ok)
+}
+
+func TestIncomingContext(t *testing.T) {
+	ctx := NewIncomingContext(context.Background(), Pairs("caller", "order-service"))
+	md, ok := FromIncomingContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "order-service", md.Get("caller"))
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		md      MD
+		wantErr bool
+	}{
+		{name: "nil"},
+		{name: "valid", md: Pairs("tenant-id", "1", "empty", "")},
+		{name: "empty key", md: MD{"": "1"}, wantErr: true},
+		{name: "key with \\r", md: MD{"tenant\rid": "1"}, wantErr: true},
+		{name: "value with \\n", md: MD{"tenant-id": "1\n2"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(tc.md)
+			assert.Equal(t, tc.wantErr, err != nil)
+		})
+	}
+}
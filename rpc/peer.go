@@ -0,0 +1,36 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+)
+
+type peerKey struct{}
+
+// Peer -> the client of the call, service methods get it by PeerFromContext
+type Peer struct {
+	Addr net.Addr
+	// nil if the connection is not TLS
+	TLS *tls.ConnectionState
+}
+
+// Certificate -> the verified certificate of the client,
+// nil if the connection is not TLS or the client certificate is not verified
+func (p *Peer) Certificate() *x509.Certificate {
+	if p.TLS == nil || len(p.TLS.VerifiedChains) == 0 || len(p.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return p.TLS.VerifiedChains[0][0]
+}
+
+func newPeerContext(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// PeerFromContext -> the client of the call
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
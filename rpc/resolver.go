@@ -0,0 +1,154 @@
+package rpc
+
+import (
+	"context"
+	"emicro/registry"
+	"emicro/rpc/balancer"
+	"sync"
+	"time"
+)
+
+var _ balancer.Node = (*instanceConn)(nil)
+
+// instanceConn -> connections to one instance of the service
+type instanceConn struct {
+	ins  registry.ServiceInstance
+	pool *connPool
+}
+
+func (i *instanceConn) Instance() registry.ServiceInstance {
+	return i.ins
+}
+
+// resolver -> keep the connections to the instances of a service up to date,
+// and pick an instance for every call
+type resolver struct {
+	registry    registry.Registry
+	serviceName string
+	timeout     time.Duration
+	builder     balancer.PickerBuilder
+	newPool     func(address string) *connPool
+
+	mutex  sync.RWMutex
+	nodes  map[string]*instanceConn
+	picker balancer.Picker
+	closed bool
+
+	close chan struct{}
+}
+
+func newResolver(r registry.Registry, serviceName string, timeout time.Duration,
+	builder balancer.PickerBuilder, newPool func(address string) *connPool) (*resolver, error) {
+	res := &resolver{
+		registry:    r,
+		serviceName: serviceName,
+		timeout:     timeout,
+		builder:     builder,
+		newPool:     newPool,
+		nodes:       make(map[string]*instanceConn, 8),
+		close:       make(chan struct{}),
+	}
+	if err := res.resolve(); err != nil {
+		return nil, err
+	}
+	events, err := r.Subscribe(serviceName)
+	if err != nil {
+		res.closeNodes()
+		return nil, err
+	}
+	go res.watch(events)
+	return res, nil
+}
+
+// resolve -> fetch all instances and update the connections
+func (r *resolver) resolve() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	instances, err := r.registry.ListServices(ctx, r.serviceName)
+	if err != nil {
+		return err
+	}
+	r.update(instances)
+	return nil
+}
+
+func (r *resolver) update(instances []registry.ServiceInstance) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return
+	}
+	nodes := make(map[string]*instanceConn, len(instances))
+	for _, ins := range instances {
+		node, ok := r.nodes[ins.Address]
+		if ok {
+			// the weight or the group may be changed
+			node = &instanceConn{ins: ins, pool: node.pool}
+		} else {
+			node = &instanceConn{ins: ins, pool: r.newPool(ins.Address)}
+		}
+		nodes[ins.Address] = node
+	}
+	for address, node := range r.nodes {
+		if _, ok := nodes[address]; !ok {
+			// the instance is removed, don't break the calls which are still running on it
+			node.pool.drain()
+		}
+	}
+	r.nodes = nodes
+	list := make([]balancer.Node, 0, len(nodes))
+	for _, node := range nodes {
+		list = append(list, node)
+	}
+	r.picker = r.builder.Build(list)
+}
+
+func (r *resolver) watch(events <-chan registry.Event) {
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+			// Same as the gRPC resolver, fetching all instances again is idempotent
+			// and does not depend on the order of the events.
+			// If it fails, keep using the current instances.
+			_ = r.resolve()
+		case <-r.close:
+			return
+		}
+	}
+}
+
+// pick -> choose an instance for the call, done must be called when the call finishes
+func (r *resolver) pick(ctx context.Context) (*connPool, func(err error), error) {
+	r.mutex.RLock()
+	picker := r.picker
+	r.mutex.RUnlock()
+	res, err := picker.Pick(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	done := res.Done
+	if done == nil {
+		done = func(err error) {}
+	}
+	return res.Node.(*instanceConn).pool, done, nil
+}
+
+func (r *resolver) closeNodes() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.closed = true
+	for _, node := range r.nodes {
+		_ = node.pool.Close()
+	}
+}
+
+// Close -> stop watching the registry and close all connections
+// The registry is not closed, it's owned by the caller.
+func (r *resolver) Close() error {
+	close(r.close)
+	r.closeNodes()
+	return nil
+}
@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"emicro/registry"
+	"emicro/registry/mocks"
+	"emicro/rpc/balancer"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestClient_Registry(t *testing.T) {
+	servers := map[string]string{
+		"127.0.0.1:8082": "server-8082",
+		"127.0.0.1:8083": "server-8083",
+	}
+	for address, msg := range servers {
+		server := NewServer()
+		_ = server.RegisterService(&UserServiceServer{Msg: msg})
+		go func(address string) {
+			err := server.Start(address)
+			t.Log(err)
+		}(address)
+		defer func() {
+			_ = server.Close()
+		}()
+	}
+	time.Sleep(time.Second * 3)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	all := []registry.ServiceInstance{
+		{Name: "user-service", Address: "127.0.0.1:8082", Weight: 10},
+		{Name: "user-service", Address: "127.0.0.1:8083", Weight: 10},
+	}
+	events := make(chan registry.Event, 1)
+	r := mocks.NewMockRegistry(ctrl)
+	r.EXPECT().ListServices(gomock.Any(), "user-service").Return(all, nil)
+	r.EXPECT().Subscribe("user-service").Return((<-chan registry.Event)(events), nil)
+
+	client, err := NewClient("user-service", ClientWithRegistry(r, time.Second),
+		ClientWithPickerBuilder(&balancer.RoundRobinBuilder{}))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	usClient := &UserServiceClient{}
+	require.NoError(t, client.InitService(usClient))
+
+	// round robin, every instance gets the same number of calls
+	got := make(map[string]int, 2)
+	for i := 0; i < 4; i++ {
+		resp, er := usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+		require.NoError(t, er)
+		got[resp.Msg]++
+	}
+	assert.Equal(t, map[string]int{"server-8082": 2, "server-8083": 2}, got)
+
+	// one instance is removed
+	updated := make(chan struct{})
+	r.EXPECT().ListServices(gomock.Any(), "user-service").
+		DoAndReturn(func(ctx context.Context, name string) ([]registry.ServiceInstance, error) {
+			defer close(updated)
+			return all[1:], nil
+		})
+	events <- registry.Event{Type: registry.EventTypeDelete, Instance: all[0]}
+	<-updated
+	// the picker is rebuilt after ListServices returns
+	time.Sleep(time.Millisecond * 100)
+	for i := 0; i < 4; i++ {
+		resp, er := usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+		require.NoError(t, er)
+		assert.Equal(t, "server-8083", resp.Msg)
+	}
+}
+
+func TestClient_RegistryNoInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	r := mocks.NewMockRegistry(ctrl)
+	r.EXPECT().ListServices(gomock.Any(), "user-service").Return(nil, nil)
+	r.EXPECT().Subscribe("user-service").Return(make(<-chan registry.Event), nil)
+
+	client, err := NewClient("user-service", ClientWithRegistry(r, time.Second))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	usClient := &UserServiceClient{}
+	require.NoError(t, client.InitService(usClient))
+	_, err = usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+	assert.ErrorIs(t, err, errs.NoAvailableInstanceError)
+}
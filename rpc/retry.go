@@ -0,0 +1,142 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/status"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy -> how the failed unary calls are retried
+// The calls which never reached the server, such as dialing failures,
+// and the ones rejected by a busy server are always retried.
+// The ones which might have been received by the server are retried only if the method
+// is idempotent, because the server may have executed them already.
+// Streaming calls are never retried.
+type RetryPolicy struct {
+	// MaxAttempts -> the maximum number of attempts, including the first one.
+	// 0 or 1 means no retry.
+	MaxAttempts int
+	// InitialBackoff -> the backoff before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff -> the upper limit of the backoff, 0 means no limit
+	MaxBackoff time.Duration
+	// Multiplier -> the backoff grows by it after every retry, values less than 1 are treated as 1
+	Multiplier float64
+	// Jitter -> in [0, 1], the backoff is randomized within backoff * (1 ± Jitter),
+	// so that the clients don't retry at the same time
+	Jitter float64
+	// RetryableCodes -> the server errors which can be retried, for example status.Unavailable.
+	// Business errors are never retried.
+	RetryableCodes []status.Code
+	// Idempotent -> the method can be executed more than once,
+	// it can also be marked per call by CtxWithIdempotent
+	Idempotent bool
+}
+
+// backoff -> the backoff before the nth retry, n starts from 1
+func (p RetryPolicy) backoff(n int) time.Duration {
+	multiplier := math.Max(p.Multiplier, 1)
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(n-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if jitter := math.Min(math.Max(p.Jitter, 0), 1); jitter > 0 {
+		backoff *= 1 + jitter*(rand.Float64()*2-1)
+	}
+	return time.Duration(backoff)
+}
+
+// retryable -> whether the failed attempt can be retried
+func (p RetryPolicy) retryable(ctx context.Context, err error) bool {
+	// the caller gave up, or the client is closed
+	if ctx.Err() != nil || errors.Is(err, errs.ClientClosedError) {
+		return false
+	}
+	var ue unsentError
+	if errors.As(err, &ue) || IsServerBusy(err) {
+		// the server never executed it
+		return true
+	}
+	if !p.Idempotent && !isIdempotent(ctx) {
+		return false
+	}
+	se, ok := status.FromError(err)
+	if !ok {
+		// the connection failed after the request was written,
+		// or the response did not arrive in time
+		return !status.IsBizError(err) && !errors.Is(err, errs.OnewayError) &&
+			!errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled)
+	}
+	for _, code := range p.RetryableCodes {
+		if se.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// unsentError -> the request was not written to the connection,
+// so the server never received it and it's safe to retry
+type unsentError struct {
+	err error
+}
+
+func (e unsentError) Error() string {
+	return e.err.Error()
+}
+
+func (e unsentError) Unwrap() error {
+	return e.err
+}
+
+// retryPolicy -> the policy of the method, the method level one takes precedence
+func (c *Client) retryPolicy(serviceName, methodName string) RetryPolicy {
+	if p, ok := c.retryPolicies[serviceName+"/"+methodName]; ok {
+		return p
+	}
+	if p, ok := c.retryPolicies[serviceName]; ok {
+		return p
+	}
+	return c.defaultRetryPolicy
+}
+
+// invokeWithRetry -> call doInvoke and retry it according to the policy of the method
+// The backoff never exceeds the deadline of ctx, the last result is returned in that case.
+func (c *Client) invokeWithRetry(ctx context.Context, request *message2.Request) (*message2.Response, error) {
+	policy := c.retryPolicy(request.ServiceName, request.MethodName)
+	for attempt := 1; ; attempt++ {
+		resp, err := c.doInvoke(ctx, request)
+		callErr := err
+		if err == nil {
+			// the server error is carried in the response
+			callErr = responseError(resp)
+		}
+		if callErr == nil || attempt >= policy.MaxAttempts || !policy.retryable(ctx, callErr) {
+			return resp, unwrapUnsent(err)
+		}
+		backoff := policy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+			return resp, unwrapUnsent(err)
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, unwrapUnsent(err)
+		case <-timer.C:
+		}
+	}
+}
+
+// unwrapUnsent -> the caller gets the original error
+func unwrapUnsent(err error) error {
+	if ue, ok := err.(unsentError); ok {
+		return ue.err
+	}
+	return err
+}
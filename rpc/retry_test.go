@@ -0,0 +1,253 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"emicro/rpc/status"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: time.Millisecond * 100,
+		MaxBackoff:     time.Millisecond * 300,
+		Multiplier:     2,
+	}
+	assert.Equal(t, time.Millisecond*100, p.backoff(1))
+	assert.Equal(t, time.Millisecond*200, p.backoff(2))
+	assert.Equal(t, time.Millisecond*300, p.backoff(3))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		backoff := p.backoff(2)
+		assert.GreaterOrEqual(t, backoff, time.Millisecond*100)
+		assert.LessOrEqual(t, backoff, time.Millisecond*300)
+	}
+}
+
+func TestRetryPolicy_retryable(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	testCases := []struct {
+		name   string
+		ctx    context.Context
+		policy RetryPolicy
+		err    error
+
+		want bool
+	}{
+		{
+			name: "unsent",
+			ctx:  context.Background(),
+			err:  unsentError{err: io.EOF},
+			want: true,
+		},
+		{
+			name: "client closed",
+			ctx:  context.Background(),
+			err:  unsentError{err: errs.ClientConnDeaded(errs.ClientClosedError)},
+		},
+		{
+			name: "cancelled",
+			ctx:  cancelled,
+			err:  unsentError{err: io.EOF},
+		},
+		{
+			name: "sent but not idempotent",
+			ctx:  context.Background(),
+			err:  io.EOF,
+		},
+		{
+			name:   "sent and idempotent",
+			ctx:    context.Background(),
+			policy: RetryPolicy{Idempotent: true},
+			err:    io.EOF,
+			want:   true,
+		},
+		{
+			name: "idempotent call",
+			ctx:  CtxWithIdempotent(context.Background()),
+			err:  io.EOF,
+			want: true,
+		},
+		{
+			name:   "deadline exceeded",
+			ctx:    context.Background(),
+			policy: RetryPolicy{Idempotent: true},
+			err:    context.DeadlineExceeded,
+		},
+		{
+			name:   "business error",
+			ctx:    context.Background(),
+			policy: RetryPolicy{Idempotent: true},
+			err:    status.NewBizError("user not found"),
+		},
+		{
+			name:   "retryable code",
+			ctx:    context.Background(),
+			policy: RetryPolicy{Idempotent: true, RetryableCodes: []status.Code{status.Unavailable}},
+			err:    status.New(status.Unavailable, "unavailable"),
+			want:   true,
+		},
+		{
+			name:   "not retryable code",
+			ctx:    context.Background(),
+			policy: RetryPolicy{Idempotent: true, RetryableCodes: []status.Code{status.Unavailable}},
+			err:    status.New(status.Internal, "internal"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.policy.retryable(tc.ctx, tc.err))
+		})
+	}
+}
+
+// flakyService -> fails with Unavailable before the failures are used up
+type flakyService struct {
+	failures int32
+	calls    int32
+}
+
+func (f *flakyService) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	atomic.AddInt32(&f.calls, 1)
+	if atomic.AddInt32(&f.failures, -1) >= 0 {
+		return nil, status.New(status.Unavailable, "try again")
+	}
+	return &GetByIdResp{Msg: "hello"}, nil
+}
+
+func (f *flakyService) Name() string {
+	return "user-service"
+}
+
+func TestClient_retry(t *testing.T) {
+	service := &flakyService{}
+	server := NewServer()
+	_ = server.RegisterService(service)
+	go func() {
+		err := server.Start(":8094")
+		t.Log(err)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	time.Sleep(time.Second)
+
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond * 10,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableCodes: []status.Code{status.Unavailable},
+	}
+	idempotent := policy
+	idempotent.Idempotent = true
+	slow := idempotent
+	slow.InitialBackoff = time.Second
+
+	testCases := []struct {
+		name     string
+		failures int32
+		timeout  time.Duration
+
+		wantCalls int32
+		wantCode  status.Code
+	}{
+		{
+			name:      "not idempotent",
+			failures:  2,
+			timeout:   time.Second,
+			wantCalls: 1,
+			wantCode:  status.Unavailable,
+		},
+		{
+			name:      "idempotent",
+			failures:  2,
+			timeout:   time.Second,
+			wantCalls: 3,
+		},
+		{
+			name:      "attempts used up",
+			failures:  3,
+			timeout:   time.Second,
+			wantCalls: 3,
+			wantCode:  status.Unavailable,
+		},
+		{
+			name:      "backoff exceeds deadline",
+			failures:  1,
+			timeout:   time.Millisecond * 500,
+			wantCalls: 1,
+			wantCode:  status.Unavailable,
+		},
+	}
+	clients := map[string]*UserServiceClient{}
+	for name, p := range map[string]RetryPolicy{
+		"not idempotent":           policy,
+		"idempotent":               idempotent,
+		"attempts used up":         idempotent,
+		"backoff exceeds deadline": slow,
+	} {
+		client, err := NewClient(":8094", ClientWithRetryPolicy(policy),
+			ClientWithMethodRetryPolicy("user-service", "GetById", p))
+		require.NoError(t, err)
+		defer func() {
+			_ = client.Close()
+		}()
+		usClient := &UserServiceClient{}
+		require.NoError(t, client.InitService(usClient))
+		clients[name] = usClient
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			atomic.StoreInt32(&service.failures, tc.failures)
+			atomic.StoreInt32(&service.calls, 0)
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			start := time.Now()
+			resp, err := clients[tc.name].GetById(ctx, &GetByIdReq{Id: 123})
+			assert.Less(t, time.Since(start), tc.timeout)
+			assert.Equal(t, tc.wantCalls, atomic.LoadInt32(&service.calls))
+			assert.Equal(t, tc.wantCode, status.CodeOf(err))
+			if err == nil {
+				assert.Equal(t, "hello", resp.Msg)
+			}
+		})
+	}
+}
+
+func TestClient_retryDial(t *testing.T) {
+	client, err := NewClient(":8095", ClientWithRetryPolicy(RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Millisecond * 200,
+	}))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	usClient := &UserServiceClient{}
+	require.NoError(t, client.InitService(usClient))
+
+	server := NewServer()
+	_ = server.RegisterService(&UserServiceServer{Msg: "hello"})
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+		err := server.Start(":8095")
+		t.Log(err)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	// the server is not started yet, the request never reached it,
+	// so it's retried even if the method is not idempotent
+	resp, err := usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resp.Msg)
+}
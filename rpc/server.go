@@ -2,36 +2,258 @@ package rpc
 
 import (
 	"context"
+	"crypto/tls"
 	"emicro/internal/errs"
 	"emicro/rpc/compress"
 	message2 "emicro/rpc/message"
+	"emicro/rpc/metadata"
 	"emicro/rpc/serialize"
 	"emicro/rpc/serialize/json"
+	"emicro/rpc/status"
 	"emicro/rpc/tcp"
+	"emicro/rpc/transport"
+	"errors"
 	"fmt"
+	"github.com/gotomicro/ekit/bean/option"
 	"io"
 	"net"
+	"os"
 	"reflect"
+	"runtime/debug"
 	"strconv"
+	"sync"
 	"time"
 )
 
+// shutdownPollInterval -> how often Shutdown checks whether the connections are idle
+const shutdownPollInterval = time.Millisecond * 50
+
+// goAwayGrace -> how long Shutdown keeps the idle connections open after GOAWAY,
+// the requests written by the clients before they receive GOAWAY arrive within it
+const goAwayGrace = time.Millisecond * 500
+
 // Server -> tcp conn Server
 type Server struct {
-	listener    net.Listener
-	services    map[string]*reflectionStub
+	mutex    sync.Mutex
+	listener net.Listener
+	// active connections
+	conns      map[*serverConn]struct{}
+	inShutdown bool
+
+	services map[string]stub
+	// the names of the services and methods, see intern
+	names       map[string]string
 	serializers []serialize.Serializer
 	compressors []compress.Compressor
+	// the maximum size of a request frame
+	maxFrameSize uint32
+	// close the connection if no frame is received within idleTimeout, 0 means never
+	idleTimeout time.Duration
+	// 0 means heartbeat is disabled
+	heartbeatInterval time.Duration
+	heartbeatTimeout  time.Duration
+	// TCP by default
+	transport transport.Transport
+	// nil means no TLS
+	tlsConfig *tls.Config
+	logger    Logger
+	// register the reflection service
+	reflection bool
+
+	interceptors []UnaryServerInterceptor
+	// invoke wrapped by interceptors
+	handler UnaryHandler
+
+	// 0 means no limit
+	maxConcurrency int
+	queueSize      int
+	serviceLimits  map[string]int
+	executor       *executor
+}
+
+// ServerWithMaxFrameSize -> option
+func ServerWithMaxFrameSize(size uint32) option.Option[Server] {
+	return func(server *Server) {
+		server.maxFrameSize = size
+	}
+}
+
+// ServerWithIdleTimeout -> close the connections which stay silent longer than timeout
+// Clients should enable heartbeat with an interval shorter than timeout,
+// otherwise idle connections and long-running calls without any frame are closed as well.
+func ServerWithIdleTimeout(timeout time.Duration) option.Option[Server] {
+	return func(server *Server) {
+		server.idleTimeout = timeout
+	}
 }
 
-// Close -> close net.Listener
+// ServerWithHeartbeat -> ping every connection every interval,
+// the connection is closed if the client does not answer within timeout
+func ServerWithHeartbeat(interval, timeout time.Duration) option.Option[Server] {
+	return func(server *Server) {
+		server.heartbeatInterval = interval
+		server.heartbeatTimeout = timeout
+	}
+}
+
+// ServerWithTLS -> serve TLS connections
+// Set config.ClientAuth to tls.RequireAndVerifyClientCert and config.ClientCAs for mutual TLS,
+// and the verified client is available by PeerFromContext.
+func ServerWithTLS(config *tls.Config) option.Option[Server] {
+	return func(server *Server) {
+		server.tlsConfig = config
+	}
+}
+
+// ServerWithTransport -> how to accept the connections, e.g. transport.Unix{} or transport.Memory,
+// the address of Start is interpreted by the transport. Default is TCP.
+func ServerWithTransport(t transport.Transport) option.Option[Server] {
+	return func(server *Server) {
+		server.transport = t
+	}
+}
+
+// ServerWithLogger -> where the errors and the panics of the service methods are reported,
+// default is the standard logger of the log package
+func ServerWithLogger(logger Logger) option.Option[Server] {
+	return func(server *Server) {
+		server.logger = logger
+	}
+}
+
+// ServerWithMaxConcurrency -> at most maxConcurrency requests and streams run at the same time,
+// and at most queueSize ones wait for their turn.
+// The others are rejected with status.ResourceExhausted immediately, see IsServerBusy.
+func ServerWithMaxConcurrency(maxConcurrency, queueSize int) option.Option[Server] {
+	return func(server *Server) {
+		server.maxConcurrency = maxConcurrency
+		server.queueSize = queueSize
+	}
+}
+
+// ServerWithServiceConcurrency -> at most maxConcurrency requests and streams of the service
+// run at the same time, the others are rejected immediately without waiting in the queue.
+func ServerWithServiceConcurrency(serviceName string, maxConcurrency int) option.Option[Server] {
+	return func(server *Server) {
+		if server.serviceLimits == nil {
+			server.serviceLimits = make(map[string]int, 4)
+		}
+		server.serviceLimits[serviceName] = maxConcurrency
+	}
+}
+
+// ServerWithInterceptors -> option
+// The interceptors run in order, the first one is the outermost.
+func ServerWithInterceptors(interceptors ...UnaryServerInterceptor) option.Option[Server] {
+	return func(server *Server) {
+		server.interceptors = append(server.interceptors, interceptors...)
+	}
+}
+
+// Close -> close net.Listener and all connections immediately
+// Use Shutdown to wait for the in-flight requests.
 func (s *Server) Close() error {
-	if s.listener != nil {
-		return s.listener.Close()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.inShutdown = true
+	err := s.closeListener()
+	for sc := range s.conns {
+		_ = sc.forceClose()
+	}
+	s.executor.stop()
+	return err
+}
+
+// Shutdown -> gracefully shut down the server
+// 1. stop accepting new connections
+// 2. send GOAWAY to the open connections, clients will not send new calls on them
+// 3. wait for the in-flight requests to finish, and close every connection once it's drained,
+// but not within goAwayGrace after GOAWAY, so the requests racing the GOAWAY are still served
+// 4. close the connections forcibly if ctx is done before step 3 finishes,
+// which cancels the contexts of the in-flight requests
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.inShutdown = true
+	err := s.closeListener()
+	conns := make([]*serverConn, 0, len(s.conns))
+	for sc := range s.conns {
+		conns = append(conns, sc)
+	}
+	s.mutex.Unlock()
+
+	for _, sc := range conns {
+		if er := sc.goAway(); er != nil {
+			s.logger.Errorf("server: sending goaway failed: %v", er)
+		}
+	}
+
+	graceEnd := time.Now().Add(goAwayGrace)
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		// the clients close the drained connections after GOAWAY by themselves,
+		// the server closes the ones left after the grace period
+		if !time.Now().Before(graceEnd) {
+			s.closeIdleConns()
+		}
+		if s.connsClosed() {
+			s.executor.stop()
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			_ = s.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeIdleConns -> close the connections without in-flight requests
+func (s *Server) closeIdleConns() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for sc := range s.conns {
+		if sc.idle() {
+			_ = sc.closeConn()
+			delete(s.conns, sc)
+		}
+	}
+}
+
+// connsClosed -> whether all connections are closed
+func (s *Server) connsClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.conns) == 0
+}
+
+// closeListener -> the caller must hold the lock
+func (s *Server) closeListener() error {
+	if s.listener == nil {
+		return nil
+	}
+	if err := s.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
 	}
 	return nil
 }
 
+// trackConn -> returns false if the server is shutting down
+func (s *Server) trackConn(sc *serverConn, add bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !add {
+		delete(s.conns, sc)
+		return true
+	}
+	if s.inShutdown {
+		return false
+	}
+	s.conns[sc] = struct{}{}
+	return true
+}
+
 //// Start -> run server
 //func (s *Server) Start(address string) error {
 //	listener, err := net.Listen("tcp", address)
@@ -42,7 +264,7 @@ func (s *Server) Close() error {
 //		conn, err := listener.Accept()
 //		if err != nil {
 //			// 可以考虑打印日志
-//			fmt.Printf("server: accept connection got error: %v", err)
+//			s.logger.Errorf("server: accept connection got error: %v", err)
 //		}
 //		go func() {
 //			if er := s.handleConn(conn); er != nil {
@@ -56,20 +278,36 @@ func (s *Server) Close() error {
 
 // Start -> run server
 func (s *Server) Start(address string) error {
-	listener, err := net.Listen("tcp", address)
+	listener, err := s.transport.Listen(address)
 	if err != nil {
 		return err
 	}
+	return s.Serve(listener)
+}
+
+// Serve -> accept the connections from listener until the server is closed
+// The listener is created by the caller, so the clients can dial it as soon as Serve is called.
+func (s *Server) Serve(listener net.Listener) error {
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+	s.mutex.Lock()
+	if s.inShutdown {
+		s.mutex.Unlock()
+		_ = listener.Close()
+		return nil
+	}
 	s.listener = listener
+	s.mutex.Unlock()
 	for {
 		conn, err := listener.Accept()
 		// closed
-		if err == net.ErrClosed {
+		if errors.Is(err, net.ErrClosed) {
 			return nil
 		}
 		if err != nil {
 			// consider printing logs
-			fmt.Printf("server: accept connection got error: %v", err)
+			s.logger.Errorf("server: accept connection got error: %v", err)
 			continue
 		}
 		go s.handleConn(conn)
@@ -77,92 +315,345 @@ func (s *Server) Start(address string) error {
 }
 
 // handleConn -> handle tcp connection
+// Requests from the same connection run concurrently,
+// and their responses are written back in the order they complete.
 func (s *Server) handleConn(conn net.Conn) {
+	sc := newServerConn(conn)
+	// the connection is tracked after the handshakes, which have their own timeout
+	peer, err := newPeer(conn)
+	if err != nil {
+		s.logger.Errorf("server: tls handshake failed: %v", err)
+		_ = conn.Close()
+		return
+	}
+	sc.peer = peer
+	if err = s.serverHandshake(sc); err != nil {
+		s.logger.Errorf("server: handshake failed: %v", err)
+		_ = conn.Close()
+		return
+	}
+	if !s.trackConn(sc, true) {
+		_ = conn.Close()
+		return
+	}
+	defer func() {
+		_ = sc.Close()
+		s.trackConn(sc, false)
+	}()
+	if s.heartbeatInterval > 0 {
+		sc.keepalive(s.heartbeatInterval, s.heartbeatTimeout)
+	}
 	for {
-		bs, err := tcp.ReadMsg(conn)
-		if err == io.EOF {
-			continue
+		if s.idleTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
 		}
+		bs, err := tcp.ReadMsgWithLimit(conn, s.maxFrameSize)
 		if err != nil {
+			// io.EOF means the client closed the connection,
+			// net.ErrClosed means the server closed it,
+			// os.ErrDeadlineExceeded means the connection is idle for too long
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) && !errors.Is(err, os.ErrDeadlineExceeded) {
+				s.logger.Errorf("server: reading request failed: %v", err)
+			}
 			return
 		}
-		req := message2.DecodeReq(bs)
-		ctx := context.Background()
-		deadline, err := strconv.ParseInt(req.Meta["deadline"], 10, 64)
-		cancel := func() {}
-		if err == nil {
-			ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(deadline))
+		sc.heartbeat.touch()
+		req, err := message2.DecodeReqWith(bs, s.intern)
+		if err != nil {
+			// a malformed frame from the client, the connection can not be trusted anymore
+			s.logger.Errorf("server: %v", err)
+			return
+		}
+		if req.Version != sc.version {
+			// the rest of the frame may be misparsed, the connection can not be used anymore
+			s.logger.Errorf("server: %v", errs.ProtocolVersionMismatch(sc.version, req.Version))
+			return
+		}
+		switch req.MessageType {
+		case message2.MessageTypePing:
+			go func() {
+				_ = sc.pong()
+			}()
+		case message2.MessageTypePong:
+		case message2.MessageTypeCancel:
+			sc.cancelCall(req.MessageId)
+		case message2.MessageTypeStreamOpen:
+			s.openStream(sc, req)
+		case message2.MessageTypeStreamData, message2.MessageTypeStreamHalfClose, message2.MessageTypeStreamReset,
+			message2.MessageTypeStreamWindowUpdate:
+			// frames of finished streams are ignored
+			if stream, ok := sc.getStream(req.MessageId); ok {
+				stream.handle(req)
+			}
+		default:
+			s.handleRequest(sc, req)
+		}
+	}
+}
+
+// requestContext -> build the context of the request with the deadline and incoming metadata in meta
+func requestContext(sc *serverConn, req *message2.Request) (context.Context, context.CancelFunc) {
+	ctx := newPeerContext(context.Background(), sc.peer)
+	ctx = metadata.NewIncomingContext(ctx, incomingMetadata(req))
+	deadline, err := strconv.ParseInt(req.Meta[metaDeadline], 10, 64)
+	if err == nil {
+		return context.WithDeadline(ctx, time.UnixMilli(deadline))
+	}
+	return context.WithCancel(ctx)
+}
+
+// incomingMetadata -> the metadata sent by the client, the framework keys are excluded
+func incomingMetadata(req *message2.Request) metadata.MD {
+	md := make(metadata.MD, len(req.Meta))
+	for k, v := range req.Meta {
+		if !isReservedMeta(k) {
+			md[k] = v
+		}
+	}
+	return md
+}
+
+// handleRequest -> invoke the service by the executor and write the response
+// The call is tracked by the connection, which cancels it when it's closed forcibly.
+func (s *Server) handleRequest(sc *serverConn, req *message2.Request) {
+	sc.begin()
+	ctx, cancel := requestContext(sc, req)
+	tracked := sc.addCall(req.MessageId, cancel)
+	s.executor.execute(ctx, req.ServiceName, func(err error) {
+		defer sc.end()
+		defer cancel()
+		if tracked {
+			defer sc.removeCall(req.MessageId)
 		}
-		resp := s.Invoke(ctx, req)
-		if req.Meta["one-way"] == "true" {
+		var resp *message2.Response
+		if err != nil {
+			resp = newStubResponse(req)
+			setResponseError(resp, rejectError(err))
+		} else {
+			resp = s.Invoke(ctx, req)
+		}
+		if req.Meta[metaOneway] == "true" {
 			// 什么也不需要处理。
-			// 这样就相当于直接把连接资源释放了，去接收下一个请求了
 			// nothing needs to be dealt with.
-			// this is equivalent to directly releasing the connection resources to receive the next request
-			cancel()
-			continue
+			return
 		}
-		// calculate and set the response head length
-		resp.CalculateHeaderLength()
-		// calculate and set the response body length
-		resp.CalculateBodyLength()
-		encode := message2.EncodeResp(resp)
-		_, err = conn.Write(encode)
-		if err != nil {
-			fmt.Printf("server: sending response failed: %v", err)
+		if er := sc.writeResp(resp); er != nil {
+			s.logger.Errorf("server: sending response failed: %v", er)
 		}
+	})
+}
+
+// rejectError -> the executor rejects the request with a status error,
+// or the context error if the request expires in the queue
+func rejectError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.New(status.CodeOf(err), err.Error())
+}
+
+// openStream -> run the streaming method in a new goroutine
+// The stream is finished by a half-close frame carrying the error returned by the method.
+func (s *Server) openStream(sc *serverConn, req *message2.Request) {
+	ctx, cancel := requestContext(sc, req)
+	stream := &serverStream{
+		ctx:        ctx,
+		cancel:     cancel,
+		conn:       sc,
+		open:       req,
+		serializer: s.serializers[req.Serializer],
+		compressor: s.compressors[req.Compresser],
+		buffer:     newStreamBuffer[*message2.Request](streamWindow),
+		window:     newSendWindow(),
+	}
+	if !sc.addStream(stream) {
 		cancel()
+		return
 	}
+	sc.begin()
+	s.executor.execute(ctx, req.ServiceName, func(err error) {
+		defer sc.end()
+		defer cancel()
+		if err != nil {
+			err = rejectError(err)
+		} else {
+			err = s.InvokeStream(stream)
+		}
+		sc.removeStream(req.MessageId)
+		if er := sc.writeResp(stream.newResponse(message2.MessageTypeStreamHalfClose, nil, err)); er != nil {
+			s.logger.Errorf("server: sending stream trailer failed: %v", er)
+		}
+	})
 }
 
-// Invoke -> server Invoke
-func (s *Server) Invoke(ctx context.Context, req *message2.Request) *message2.Response {
-	stub, ok := s.services[req.ServiceName]
+// InvokeStream -> server invoke streaming method
+// A panic of the method is recovered and returned as status.Internal.
+func (s *Server) InvokeStream(stream *serverStream) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = s.recovered(stream.open.ServiceName, stream.open.MethodName, r)
+		}
+	}()
+	if stream.serializer == nil || stream.compressor == nil {
+		return status.New(status.Unimplemented,
+			errs.UnsupportedCodec(stream.open.Serializer, stream.open.Compresser).Error())
+	}
+	stub, ok := s.services[stream.open.ServiceName]
 	if !ok {
-		return &message2.Response{
-			Version:    req.Version,
-			Compresser: req.Compresser,
-			Serializer: req.Serializer,
-			MessageId:  req.MessageId,
-			Error:      []byte(errs.InvalidServiceName.Error()),
+		return status.New(status.Unimplemented, errs.InvalidServiceName.Error())
+	}
+	return stub.InvokeStream(stream)
+}
+
+// Invoke -> server Invoke, the request goes through the interceptors
+// A panic of the method or the interceptors is recovered and returned as status.Internal.
+func (s *Server) Invoke(ctx context.Context, req *message2.Request) (resp *message2.Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = newStubResponse(req)
+			setResponseError(resp, s.recovered(req.ServiceName, req.MethodName, r))
 		}
+	}()
+	return s.handler(ctx, req)
+}
+
+// recovered -> the panic and the stack trace are only logged, the client gets an internal error
+func (s *Server) recovered(serviceName, methodName string, r any) error {
+	err := errs.MethodPanicked(serviceName, methodName)
+	s.logger.Errorf("server: %v: %v\n%s", err, r, debug.Stack())
+	return status.New(status.Internal, err.Error())
+}
+
+// invoke -> dispatch the request to the service stub
+func (s *Server) invoke(ctx context.Context, req *message2.Request) *message2.Response {
+	stub, ok := s.services[req.ServiceName]
+	if !ok {
+		return NewErrorResponse(req, status.New(status.Unimplemented, errs.InvalidServiceName.Error()))
 	}
 	return stub.Invoke(ctx, req)
 }
 
 // NewServer instance
-func NewServer() *Server {
+func NewServer(opts ...option.Option[Server]) *Server {
 	res := &Server{
-		services: make(map[string]*reflectionStub, 8),
+		conns:    make(map[*serverConn]struct{}, 16),
+		services: make(map[string]stub, 8),
+		names:    make(map[string]string, 32),
 		// A byte can have up to 256 implementations, which can be directly made into a simple bit array
 		// 一个字节，最多有 256 个实现，直接做成一个简单的 bit array 的东西
-		serializers: make([]serialize.Serializer, 256),
-		compressors: make([]compress.Compressor, 256),
+		serializers:  make([]serialize.Serializer, 256),
+		compressors:  make([]compress.Compressor, 256),
+		maxFrameSize: tcp.DefaultMaxFrameSize,
+		transport:    transport.TCP{},
+		logger:       stdLogger{},
+	}
+	for _, opt := range opts {
+		opt(res)
 	}
+	// the framework keys are in almost every request
+	res.addNames(metaOneway, metaDeadline)
+	res.handler = chainUnaryServerInterceptors(res.interceptors, res.invoke)
+	res.executor = newExecutor(res.maxConcurrency, res.queueSize, res.serviceLimits)
 	// Register the most basic serialization protocol
 	res.RegisterSerializer(json.Serializer{})
 	res.RegisterCompressor(compress.DoNothingCompressor{})
+	if res.reflection {
+		_ = res.RegisterService(&serverReflection{server: res})
+	}
 	return res
 }
 
+// RegisterServiceDesc -> register the service with the generated dispatch table
+// impl must implement the service interface which desc is generated from.
+func (s *Server) RegisterServiceDesc(desc *ServiceDesc, impl any) error {
+	if desc == nil || impl == nil {
+		return errs.ServiceNilError
+	}
+	s.addNames(desc.ServiceName)
+	for name := range desc.Methods {
+		s.addNames(name)
+	}
+	for name := range desc.Streams {
+		s.addNames(name)
+	}
+	s.services[desc.ServiceName] = &descStub{
+		desc:        desc,
+		impl:        impl,
+		serializers: s.serializers,
+		compressors: s.compressors,
+	}
+	return nil
+}
+
 // RegisterService -> Service stub
+// It dispatches the requests by reflection, use RegisterServiceDesc with the generated code instead.
+// All the exported methods except Name must be unary or streaming methods, see isUnaryMethod and isStreamMethod,
+// otherwise an error listing the invalid methods is returned and nothing is registered.
 func (s *Server) RegisterService(service Service) error {
+	if service == nil {
+		return errs.ServiceNilError
+	}
 	val := reflect.ValueOf(service)
-	typ := reflect.TypeOf(service)
 	methods := make(map[string]reflect.Value, val.NumMethod())
+	streams := make(map[string]reflect.Value, 2)
+	var invalid []string
 	for i := 0; i < val.NumMethod(); i++ {
-		methodTyp := typ.Method(i)
-		methods[methodTyp.Name] = val.Method(i)
+		name := val.Type().Method(i).Name
+		// Name of Service
+		if name == "Name" {
+			continue
+		}
+		method := val.Method(i)
+		switch {
+		case isStreamMethod(method.Type()):
+			if !isValidStreamMethod(method.Type()) {
+				invalid = append(invalid, fmt.Sprintf("%s %v is not a streaming method", name, method.Type()))
+				continue
+			}
+			streams[name] = method
+		case isUnaryMethod(method.Type()):
+			methods[name] = method
+		default:
+			invalid = append(invalid, fmt.Sprintf("%s %v is not func(context.Context, *Req) (*Resp, error)", name, method.Type()))
+		}
+	}
+	if len(invalid) > 0 {
+		return errs.InvalidServiceMethods(service.Name(), invalid)
+	}
+	s.addNames(service.Name())
+	for name := range methods {
+		s.addNames(name)
+	}
+	for name := range streams {
+		s.addNames(name)
 	}
 	s.services[service.Name()] = &reflectionStub{
 		s:           service,
 		methods:     methods,
+		streams:     streams,
 		serializers: s.serializers,
 		compressors: s.compressors,
 	}
 	return nil
 }
 
+// addNames -> the names which are interned when decoding the requests
+func (s *Server) addNames(names ...string) {
+	for _, name := range names {
+		s.names[name] = name
+	}
+}
+
+// intern -> the registered name equal to b, so the names of the requests are not allocated.
+// The services are registered before Start, so s.names is read-only when requests come.
+func (s *Server) intern(b []byte) string {
+	// the compiler does not allocate for the conversion used as a map key
+	if name, ok := s.names[string(b)]; ok {
+		return name
+	}
+	return string(b)
+}
+
 // MustRegister -> panic error
 func (s *Server) MustRegister(service Service) {
 	err := s.RegisterService(service)
@@ -187,58 +678,122 @@ type reflectionStub struct {
 	serializers []serialize.Serializer
 	compressors []compress.Compressor
 	methods     map[string]reflect.Value
+	streams     map[string]reflect.Value
+}
+
+// isStreamMethod -> streaming methods receive a ServerStream
+// server-streaming: func(ctx context.Context, req *Req, stream ServerStream) error
+// client-streaming: func(ctx context.Context, stream ServerStream) (*Resp, error)
+// bidirectional streaming: func(ctx context.Context, stream ServerStream) error
+func isStreamMethod(typ reflect.Type) bool {
+	for i := 0; i < typ.NumIn(); i++ {
+		if typ.In(i) == serverStreamType {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnaryMethod -> func(ctx context.Context, req *Req) (*Resp, error)
+func isUnaryMethod(typ reflect.Type) bool {
+	return typ.NumIn() == 2 && typ.In(0) == contextType && typ.In(1).Kind() == reflect.Pointer &&
+		typ.NumOut() == 2 && typ.Out(0).Kind() == reflect.Pointer && typ.Out(1) == errorType
+}
+
+// isValidStreamMethod -> one of the three forms of isStreamMethod
+func isValidStreamMethod(typ reflect.Type) bool {
+	if typ.NumIn() < 2 || typ.In(0) != contextType || typ.In(typ.NumIn()-1) != serverStreamType ||
+		typ.NumOut() == 0 || typ.Out(typ.NumOut()-1) != errorType {
+		return false
+	}
+	switch {
+	case typ.NumIn() == 3:
+		return typ.In(1).Kind() == reflect.Pointer && typ.NumOut() == 1
+	case typ.NumIn() == 2 && typ.NumOut() == 2:
+		return typ.Out(0).Kind() == reflect.Pointer
+	default:
+		return typ.NumIn() == 2 && typ.NumOut() == 1
+	}
+}
+
+func (s *reflectionStub) describe() []MethodInfo {
+	methods := make([]MethodInfo, 0, len(s.methods)+len(s.streams))
+	for name, method := range s.methods {
+		methods = append(methods, describeMethod(name, method.Type()))
+	}
+	for name, method := range s.streams {
+		methods = append(methods, describeMethod(name, method.Type()))
+	}
+	return sortMethods(methods)
+}
+
+// InvokeStream -> stub execute streaming method by reflect
+func (s *reflectionStub) InvokeStream(stream *serverStream) error {
+	method, ok := s.streams[stream.open.MethodName]
+	if !ok {
+		return status.New(status.Unimplemented, errs.NotFoundServiceMethod(stream.open.MethodName).Error())
+	}
+	typ := method.Type()
+	ctxVal := reflect.ValueOf(stream.ctx)
+	streamVal := reflect.ValueOf(stream)
+	switch {
+	case typ.NumIn() == 3:
+		// server-streaming, the only request comes first
+		in := reflect.New(typ.In(1).Elem())
+		if err := stream.Recv(in.Interface()); err != nil {
+			return err
+		}
+		res := method.Call([]reflect.Value{ctxVal, in, streamVal})
+		return toError(res[0])
+	case typ.NumOut() == 2:
+		// client-streaming, the response is sent as the last message
+		res := method.Call([]reflect.Value{ctxVal, streamVal})
+		if !res[0].IsNil() {
+			if err := stream.Send(res[0].Interface()); err != nil {
+				return err
+			}
+		}
+		return toError(res[1])
+	default:
+		res := method.Call([]reflect.Value{ctxVal, streamVal})
+		return toError(res[0])
+	}
+}
+
+func toError(val reflect.Value) error {
+	if val.IsNil() {
+		return nil
+	}
+	return val.Interface().(error)
 }
 
 // Invoke -> stub execute method by reflect
 func (s *reflectionStub) Invoke(ctx context.Context, req *message2.Request) *message2.Response {
-	response := &message2.Response{
-		Version:    req.Version,
-		Compresser: req.Compresser,
-		// Theoretically, you can use another serialization protocol here,
-		// but it is unnecessary to expose this function to users
-		Serializer: req.Serializer,
-		MessageId:  req.MessageId,
-	}
+	response := newStubResponse(req)
 	method, ok := s.methods[req.MethodName]
 	if !ok {
-		response.Error = []byte(errs.NotFoundServiceMethod(req.MethodName).Error())
+		setResponseError(response, status.New(status.Unimplemented, errs.NotFoundServiceMethod(req.MethodName).Error()))
 		return response
 	}
-	in := reflect.New(method.Type().In(1).Elem())
-
-	// decompress request data
-	compresser := s.compressors[req.Compresser]
-	reqData, err := compresser.UnCompress(req.Data)
+	codecs, err := negotiate(req, response, s.serializers, s.compressors)
 	if err != nil {
-		response.Error = []byte(err.Error())
+		setResponseError(response, err)
 		return response
 	}
-	// deserialize Request Data
-	// err := json.Unmarshal(reqData, in.Interface())
-	serializer := s.serializers[req.Serializer]
-	err = serializer.Decode(reqData, in.Interface())
-	if err != nil {
-		response.Error = []byte(err.Error())
+	in := reflect.New(method.Type().In(1).Elem())
+	if err = decodeRequest(req, codecs.reqSerializer, codecs.reqCompressor, in.Interface()); err != nil {
+		setResponseError(response, err)
 		return response
 	}
 	res := method.Call([]reflect.Value{reflect.ValueOf(ctx), in})
 	if len(res) > 1 && res[1].Interface() != nil {
-		response.Error = []byte(res[1].Interface().(error).Error())
-		return response
+		// the error returned by the method, it's a business error unless it's a *status.Error
+		setResponseError(response, res[1].Interface().(error))
 	}
-	// serialize response data
-	respData, err := serializer.Encode(res[0].Interface())
-	if err != nil {
-		// server error
-		response.Error = []byte(err.Error())
-		return response
-	}
-	// compress response data
-	respData, err = compresser.Compress(respData)
-	if err != nil {
-		response.Error = []byte(err.Error())
+	// the service may return both data and error, so the data still needs to be sent back
+	if res[0].IsNil() {
 		return response
 	}
-	response.Data = respData
+	encodeResponse(response, codecs.respSerializer, codecs.respCompressor, res[0].Interface())
 	return response
 }
@@ -0,0 +1,179 @@
+package rpc
+
+import (
+	"context"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/tcp"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// serverConn -> server side of a multiplexed connection
+// Requests from the same connection are handled concurrently,
+// so writing responses must be serialized.
+type serverConn struct {
+	conn net.Conn
+	// the negotiated protocol version, set by the handshake before any other frame
+	version uint8
+	// the client, set before any request is handled
+	peer       *Peer
+	writeMutex sync.Mutex
+	// in-flight requests and streams
+	wg       sync.WaitGroup
+	inflight int64
+
+	mutex   sync.Mutex
+	streams map[uint32]*serverStream
+	// the cancel functions of the in-flight unary calls, see MessageTypeCancel
+	calls map[uint32]context.CancelFunc
+
+	heartbeat heartbeat
+	// closed when the connection is closed
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newServerConn(conn net.Conn) *serverConn {
+	return &serverConn{
+		conn:    conn,
+		streams: make(map[uint32]*serverStream, 4),
+		calls:   make(map[uint32]context.CancelFunc, 16),
+		done:    make(chan struct{}),
+	}
+}
+
+// writeResp -> encode the header into a pooled buffer and write it with the data
+func (c *serverConn) writeResp(resp *message2.Response) error {
+	// calculate and set the response head length
+	resp.CalculateHeaderLength()
+	// calculate and set the response body length
+	resp.CalculateBodyLength()
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = message2.AppendRespHeader(*buf, resp)
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return tcp.WriteBuffers(c.conn, *buf, resp.Data)
+}
+
+// begin -> a request or a stream starts
+func (c *serverConn) begin() {
+	c.wg.Add(1)
+	atomic.AddInt64(&c.inflight, 1)
+}
+
+// end -> a request or a stream finishes
+func (c *serverConn) end() {
+	atomic.AddInt64(&c.inflight, -1)
+	c.wg.Done()
+}
+
+func (c *serverConn) idle() bool {
+	return atomic.LoadInt64(&c.inflight) == 0
+}
+
+// goAway -> tell the client not to send new calls on this connection
+func (c *serverConn) goAway() error {
+	return c.writeResp(&message2.Response{Version: c.version, MessageType: message2.MessageTypeGoAway})
+}
+
+// keepalive -> ping the client, close the connection if it's unresponsive
+func (c *serverConn) keepalive(interval, timeout time.Duration) {
+	go c.heartbeat.run(interval, timeout, c.done, func() error {
+		return c.writeResp(&message2.Response{Version: c.version, MessageType: message2.MessageTypePing})
+	}, func() {
+		_ = c.forceClose()
+	})
+}
+
+// pong -> answer the ping of the client
+func (c *serverConn) pong() error {
+	return c.writeResp(&message2.Response{Version: c.version, MessageType: message2.MessageTypePong})
+}
+
+// addStream -> false if the stream id is already in use
+func (c *serverConn) addStream(stream *serverStream) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.streams[stream.open.MessageId]; ok {
+		return false
+	}
+	c.streams[stream.open.MessageId] = stream
+	return true
+}
+
+func (c *serverConn) getStream(id uint32) (*serverStream, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stream, ok := c.streams[id]
+	return stream, ok
+}
+
+func (c *serverConn) removeStream(id uint32) {
+	c.mutex.Lock()
+	delete(c.streams, id)
+	c.mutex.Unlock()
+}
+
+// addCall -> false if the id is already in use,
+// then the call can not be cancelled by the client or with the connection
+func (c *serverConn) addCall(id uint32, cancel context.CancelFunc) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.calls[id]; ok {
+		return false
+	}
+	c.calls[id] = cancel
+	return true
+}
+
+func (c *serverConn) removeCall(id uint32) {
+	c.mutex.Lock()
+	delete(c.calls, id)
+	c.mutex.Unlock()
+}
+
+// cancelCall -> the client gave up the call, the finished or unknown calls are ignored
+func (c *serverConn) cancelCall(id uint32) {
+	c.mutex.Lock()
+	cancel, ok := c.calls[id]
+	c.mutex.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// cancelInflight -> the responses can not be sent anymore, stop the in-flight calls and streams
+func (c *serverConn) cancelInflight() {
+	c.mutex.Lock()
+	for _, cancel := range c.calls {
+		cancel()
+	}
+	for _, stream := range c.streams {
+		stream.cancel()
+		stream.buffer.close(context.Canceled)
+	}
+	c.mutex.Unlock()
+}
+
+// forceClose -> close the connection without waiting for in-flight requests
+func (c *serverConn) forceClose() error {
+	c.cancelInflight()
+	return c.closeConn()
+}
+
+// Close -> wait for in-flight requests and then close the connection
+func (c *serverConn) Close() error {
+	c.cancelInflight()
+	c.wg.Wait()
+	return c.closeConn()
+}
+
+func (c *serverConn) closeConn() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return c.conn.Close()
+}
@@ -1 +1,237 @@
 package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Shutdown(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sleep   time.Duration
+		timeout time.Duration
+
+		wantShutdownErr error
+		wantCallErr     bool
+	}{
+		{
+			name:    "drained",
+			sleep:   time.Second,
+			timeout: time.Second * 3,
+		},
+		{
+			name:            "forced",
+			sleep:           time.Second * 3,
+			timeout:         time.Millisecond * 500,
+			wantShutdownErr: context.DeadlineExceeded,
+			wantCallErr:     true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer()
+			service := &UserServiceServerTimeout{t: t, sleep: tc.sleep, Msg: "hello, world"}
+			_ = server.RegisterService(service)
+			go func() {
+				err := server.Start(":8081")
+				t.Log(err)
+			}()
+			time.Sleep(time.Second * 3)
+
+			usClient := &UserServiceClient{}
+			client, err := NewClient(":8081")
+			require.NoError(t, err)
+			defer func() {
+				_ = client.Close()
+			}()
+			err = client.InitService(usClient)
+			require.NoError(t, err)
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+				resp, er := usClient.GetById(ctx, &GetByIdReq{Id: 123})
+				if tc.wantCallErr {
+					assert.Error(t, er)
+					return
+				}
+				assert.NoError(t, er)
+				assert.Equal(t, &GetByIdResp{Msg: "hello, world"}, resp)
+			}()
+			// make sure the call is in flight
+			time.Sleep(time.Millisecond * 200)
+
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			err = server.Shutdown(ctx)
+			assert.Equal(t, tc.wantShutdownErr, err)
+			wg.Wait()
+
+			// the server does not accept new calls anymore
+			ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_, err = usClient.GetById(ctx, &GetByIdReq{Id: 123})
+			assert.Error(t, err)
+			assert.False(t, errors.Is(err, context.DeadlineExceeded))
+		})
+	}
+}
+
+func TestServer_ShutdownRacingCalls(t *testing.T) {
+	server := NewServer()
+	require.NoError(t, server.RegisterService(&shutdownService{}))
+	go func() {
+		err := server.Start(":8101")
+		t.Log(err)
+	}()
+	time.Sleep(time.Second * 3)
+	client, err := NewClient(":8101", ClientWithMaxConns(2))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	usClient := &UserServiceClient{}
+	require.NoError(t, client.InitService(usClient))
+
+	var (
+		stop    int32
+		wg      sync.WaitGroup
+		served  int64
+		unsent  int64
+		written int64
+	)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&stop) == 0 {
+				_, er := usClient.GetById(context.Background(), &GetByIdReq{Id: 2})
+				switch {
+				case er == nil:
+					atomic.AddInt64(&served, 1)
+				case errors.Is(er, syscall.ECONNREFUSED) || errors.Is(er, errs.ConnGoAwayError):
+					// the request never reached the server, the listener is closed
+					// or the connection is closed after GOAWAY before the request is sent
+					atomic.AddInt64(&unsent, 1)
+				default:
+					// the request was written but its response is lost
+					atomic.AddInt64(&written, 1)
+					t.Errorf("call failed after the request was written: %v", er)
+				}
+			}
+		}()
+	}
+	// the calls are racing the GOAWAY
+	time.Sleep(time.Millisecond * 100)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	assert.NoError(t, server.Shutdown(ctx))
+	time.Sleep(time.Millisecond * 100)
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+
+	assert.Greater(t, atomic.LoadInt64(&served), int64(0))
+	assert.Greater(t, atomic.LoadInt64(&unsent), int64(0))
+	assert.Equal(t, int64(0), atomic.LoadInt64(&written))
+}
+
+func TestServer_ShutdownIgnoredGoAway(t *testing.T) {
+	server := NewServer()
+	require.NoError(t, server.RegisterService(&shutdownService{}))
+	go func() {
+		err := server.Start(":8102")
+		t.Log(err)
+	}()
+	time.Sleep(time.Second * 3)
+	// the client never closes its idle connection
+	conn, err := net.Dial("tcp", ":8102")
+	require.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	// ctx without deadline, the server closes the connection after the grace period
+	start := time.Now()
+	assert.NoError(t, server.Shutdown(context.Background()))
+	assert.Less(t, time.Since(start), goAwayGrace+time.Second)
+	_, err = io.ReadAll(conn)
+	assert.NoError(t, err)
+}
+
+func TestServer_ShutdownCancelsCalls(t *testing.T) {
+	server := NewServer()
+	service := &shutdownService{canceled: make(chan error, 1)}
+	require.NoError(t, server.RegisterService(service))
+	go func() {
+		err := server.Start(":8103")
+		t.Log(err)
+	}()
+	time.Sleep(time.Second * 3)
+	client, err := NewClient(":8103")
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	usClient := &UserServiceClient{}
+	require.NoError(t, client.InitService(usClient))
+
+	callErr := make(chan error, 1)
+	go func() {
+		// the handler blocks until its ctx is done
+		_, er := usClient.GetById(context.Background(), &GetByIdReq{Id: -1})
+		callErr <- er
+	}()
+	time.Sleep(time.Millisecond * 200)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, server.Shutdown(ctx))
+	select {
+	case err = <-service.canceled:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("the handler is not cancelled by the forced shutdown")
+	}
+	select {
+	case err = <-callErr:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the call is not failed by the forced shutdown")
+	}
+}
+
+// shutdownService -> GetById sleeps Id milliseconds,
+// a negative Id blocks until ctx is done and reports the error of ctx
+type shutdownService struct {
+	canceled chan error
+}
+
+func (s *shutdownService) Name() string {
+	return "user-service"
+}
+
+func (s *shutdownService) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	if req.Id >= 0 {
+		time.Sleep(time.Duration(req.Id) * time.Millisecond)
+		return &GetByIdResp{Msg: strconv.Itoa(req.Id)}, nil
+	}
+	<-ctx.Done()
+	s.canceled <- ctx.Err()
+	return nil, ctx.Err()
+}
@@ -0,0 +1,184 @@
+package rpc
+
+import (
+	"context"
+	"emicro/rpc/serialize/json"
+	"github.com/gotomicro/ekit/bean/option"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ReflectionServiceName -> the built-in service enabled by ServerWithReflection,
+// it describes the services of the server, like the server reflection of grpc
+const ReflectionServiceName = "emicro.reflection"
+
+// the kinds of the methods
+const (
+	MethodKindUnary           = "unary"
+	MethodKindServerStreaming = "server-streaming"
+	MethodKindClientStreaming = "client-streaming"
+	MethodKindBidiStreaming   = "bidi-streaming"
+	// the streaming method registered by RegisterServiceDesc, whose kind is unknown
+	MethodKindStreaming = "streaming"
+)
+
+// ListServicesReq -> the request of ListServices
+type ListServicesReq struct{}
+
+// ServerInfo -> what the server exposes
+type ServerInfo struct {
+	// sorted by name
+	Services []ServiceInfo
+	// the codes of the registered serializers and compressors
+	Serializers []uint8
+	Compressors []uint8
+}
+
+// ServiceInfo -> a registered service
+type ServiceInfo struct {
+	Name string
+	// sorted by name
+	Methods []MethodInfo
+}
+
+// MethodInfo -> a method of the service
+// The types are nil if the service is registered by RegisterServiceDesc,
+// and for the streaming methods which have no typed request or response.
+type MethodInfo struct {
+	Name     string
+	Kind     string
+	Request  *TypeInfo
+	Response *TypeInfo
+}
+
+// TypeInfo -> the Go type of the request or the response
+type TypeInfo struct {
+	// e.g. rpc.GetByIdReq
+	Name string
+	// the exported fields if it's a struct
+	Fields []FieldInfo
+}
+
+// FieldInfo -> a field of the struct
+type FieldInfo struct {
+	Name string
+	// the Go type, e.g. []string
+	Type string
+	// the name in the json tag, or the field name
+	JSONName string
+}
+
+// ServerWithReflection -> register the reflection service, see ReflectionServiceName
+func ServerWithReflection() option.Option[Server] {
+	return func(server *Server) {
+		server.reflection = true
+	}
+}
+
+// serverReflection -> the implementation of the reflection service
+type serverReflection struct {
+	server *Server
+}
+
+func (r *serverReflection) Name() string {
+	return ReflectionServiceName
+}
+
+// ListServices -> describe the services, serializers and compressors
+func (r *serverReflection) ListServices(ctx context.Context, req *ListServicesReq) (*ServerInfo, error) {
+	s := r.server
+	info := &ServerInfo{
+		Services: make([]ServiceInfo, 0, len(s.services)),
+	}
+	for name, stub := range s.services {
+		info.Services = append(info.Services, ServiceInfo{
+			Name:    name,
+			Methods: stub.describe(),
+		})
+	}
+	sort.Slice(info.Services, func(i, j int) bool {
+		return info.Services[i].Name < info.Services[j].Name
+	})
+	for code, serializer := range s.serializers {
+		if serializer != nil {
+			info.Serializers = append(info.Serializers, uint8(code))
+		}
+	}
+	for code, compressor := range s.compressors {
+		if compressor != nil {
+			info.Compressors = append(info.Compressors, uint8(code))
+		}
+	}
+	return info, nil
+}
+
+// ListServices -> query the reflection service of the server,
+// the server must be created with ServerWithReflection.
+// It's always encoded by json whatever the serializer of the client is.
+func (c *Client) ListServices(ctx context.Context) (*ServerInfo, error) {
+	info := &ServerInfo{}
+	err := c.CallWithSerializer(ctx, json.Serializer{}, ReflectionServiceName, "ListServices", &ListServicesReq{}, info)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// describeMethod -> the method of the service registered by RegisterService
+func describeMethod(name string, typ reflect.Type) MethodInfo {
+	info := MethodInfo{Name: name, Kind: MethodKindUnary}
+	switch {
+	case !isStreamMethod(typ):
+		info.Request = describeType(typ.In(1))
+		info.Response = describeType(typ.Out(0))
+	case typ.NumIn() == 3:
+		info.Kind = MethodKindServerStreaming
+		info.Request = describeType(typ.In(1))
+	case typ.NumOut() == 2:
+		info.Kind = MethodKindClientStreaming
+		info.Response = describeType(typ.Out(0))
+	default:
+		info.Kind = MethodKindBidiStreaming
+	}
+	return info
+}
+
+// describeType -> typ is a pointer
+func describeType(typ reflect.Type) *TypeInfo {
+	typ = typ.Elem()
+	info := &TypeInfo{Name: typ.String()}
+	if typ.Kind() != reflect.Struct {
+		return info
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		jsonName := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			name, _, _ := strings.Cut(tag, ",")
+			if name == "-" {
+				continue
+			}
+			if name != "" {
+				jsonName = name
+			}
+		}
+		info.Fields = append(info.Fields, FieldInfo{
+			Name:     field.Name,
+			Type:     field.Type.String(),
+			JSONName: jsonName,
+		})
+	}
+	return info
+}
+
+// sortMethods -> the methods are listed by name
+func sortMethods(methods []MethodInfo) []MethodInfo {
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Name < methods[j].Name
+	})
+	return methods
+}
@@ -0,0 +1,109 @@
+package rpc
+
+import (
+	"context"
+	"emicro/rpc/compress/gzip"
+	"emicro/rpc/serialize/proto"
+	"emicro/rpc/status"
+	"emicro/rpc/transport"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerReflection(t *testing.T) {
+	mem := transport.NewMemory(0)
+	server := NewServer(ServerWithTransport(mem), ServerWithReflection())
+	server.RegisterSerializer(proto.Serializer{})
+	server.RegisterCompressor(gzip.Compressor{})
+	require.NoError(t, server.RegisterService(&echoService{}))
+	require.NoError(t, server.RegisterService(&StreamServiceServer{}))
+	require.NoError(t, server.RegisterServiceDesc(&ServiceDesc{
+		ServiceName: "order-service",
+		Methods: map[string]MethodHandler{
+			"Create": func(srv any, ctx context.Context, dec func(in any) error) (any, error) {
+				return nil, nil
+			},
+		},
+		Streams: map[string]StreamHandler{
+			"Watch": func(srv any, stream ServerStream) error {
+				return nil
+			},
+		},
+	}, struct{}{}))
+	listener, err := mem.Listen("server")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+
+	// the reflection service is encoded by json whatever the client uses
+	client, err := NewClient("server", ClientWithTransport(mem), ClientWithSerializer(proto.Serializer{}))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	info, err := client.ListServices(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []uint8{1, 2}, info.Serializers)
+	assert.Equal(t, []uint8{0, 1}, info.Compressors)
+	names := make([]string, 0, len(info.Services))
+	for _, svc := range info.Services {
+		names = append(names, svc.Name)
+	}
+	assert.Equal(t, []string{ReflectionServiceName, "order-service", "stream-service", "user-service"}, names)
+
+	assert.Equal(t, []MethodInfo{
+		{Name: "Create", Kind: MethodKindUnary},
+		{Name: "Watch", Kind: MethodKindStreaming},
+	}, info.Services[1].Methods)
+	assert.Equal(t, []MethodInfo{
+		{
+			Name: "Echo",
+			Kind: MethodKindBidiStreaming,
+		},
+		{
+			Name:    "ListUsers",
+			Kind:    MethodKindServerStreaming,
+			Request: &TypeInfo{Name: "rpc.GetByIdReq", Fields: []FieldInfo{{Name: "Id", Type: "int", JSONName: "Id"}}},
+		},
+		{
+			Name:     "Sum",
+			Kind:     MethodKindClientStreaming,
+			Response: &TypeInfo{Name: "rpc.GetByIdResp", Fields: []FieldInfo{{Name: "Msg", Type: "string", JSONName: "Msg"}}},
+		},
+	}, info.Services[2].Methods)
+	assert.Equal(t, []MethodInfo{
+		{
+			Name:     "GetById",
+			Kind:     MethodKindUnary,
+			Request:  &TypeInfo{Name: "rpc.GetByIdReq", Fields: []FieldInfo{{Name: "Id", Type: "int", JSONName: "Id"}}},
+			Response: &TypeInfo{Name: "rpc.GetByIdResp", Fields: []FieldInfo{{Name: "Msg", Type: "string", JSONName: "Msg"}}},
+		},
+	}, info.Services[3].Methods)
+}
+
+func TestServerReflection_disabled(t *testing.T) {
+	mem := transport.NewMemory(0)
+	server := NewServer(ServerWithTransport(mem))
+	listener, err := mem.Listen("server")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	client, err := NewClient("server", ClientWithTransport(mem))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	_, err = client.ListServices(context.Background())
+	assert.Equal(t, status.Unimplemented, status.CodeOf(err))
+}
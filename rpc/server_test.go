@@ -2,10 +2,13 @@ package rpc
 
 import (
 	"context"
+	"emicro/internal/errs"
 	"emicro/rpc/compress"
 	"emicro/rpc/compress/gzip"
 	message2 "emicro/rpc/message"
+	"emicro/rpc/status"
 	"emicro/rpc/tcp"
+	"emicro/rpc/transport"
 	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
@@ -13,6 +16,7 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
@@ -49,7 +53,8 @@ func testServerHandleConnection(t *testing.T, c compress.Compressor) {
 		require.NoError(t, err)
 		err = server.TestHandleConn(tc.conn)
 		require.NoError(t, err)
-		resp := message2.DecodeResp(tc.conn.writeData)
+		resp, err := message2.DecodeResp(tc.conn.writeData)
+		require.NoError(t, err)
 		assert.Equal(t, tc.wantResp, resp.Data)
 
 	}
@@ -66,7 +71,10 @@ func (s *Server) TestHandleConn(conn net.Conn) error {
 			return fmt.Errorf("emicro: server sending response failed: %v", err)
 		}
 
-		req := message2.DecodeReq(bs)
+		req, err := message2.DecodeReq(bs)
+		if err != nil {
+			return err
+		}
 		ctx := context.Background()
 		deadline, err := strconv.ParseInt(req.Meta["deadline"], 10, 64)
 		cancel := func() {}
@@ -75,11 +83,11 @@ func (s *Server) TestHandleConn(conn net.Conn) error {
 		}
 
 		resp := s.Invoke(ctx, req)
+		cancel()
 
 		if req.Meta["one-way"] == "true" {
 			// 什么也不需要处理。
 			// 这样就相当于直接把连接资源释放了，去接收下一个请求了
-			cancel()
 			continue
 		}
 
@@ -92,7 +100,6 @@ func (s *Server) TestHandleConn(conn net.Conn) error {
 		if er != nil {
 			return fmt.Errorf("emicro: server sending response failed: %v", er)
 		}
-		cancel()
 		return nil
 	}
 }
@@ -162,3 +169,190 @@ func (m *mockConn) Write(bs []byte) (int, error) {
 	m.writeData = append(m.writeData, bs...)
 	return len(bs), m.writeErr
 }
+
+type invalidService struct{}
+
+func (i *invalidService) Name() string {
+	return "invalid-service"
+}
+
+func (i *invalidService) GetById(ctx context.Context, req *AnyRequest) (*AnyResponse, error) {
+	return &AnyResponse{}, nil
+}
+
+func (i *invalidService) NoContext(req *AnyRequest) (*AnyResponse, error) {
+	return &AnyResponse{}, nil
+}
+
+func (i *invalidService) NoError(ctx context.Context, req *AnyRequest) *AnyResponse {
+	return &AnyResponse{}
+}
+
+func (i *invalidService) ValueRequest(ctx context.Context, req AnyRequest) (*AnyResponse, error) {
+	return &AnyResponse{}, nil
+}
+
+func (i *invalidService) BadStream(ctx context.Context, stream ServerStream) *AnyResponse {
+	return nil
+}
+
+func TestServer_RegisterService(t *testing.T) {
+	server := NewServer()
+	assert.Equal(t, errs.ServiceNilError, server.RegisterService(nil))
+
+	err := server.RegisterService(&invalidService{})
+	assert.ErrorIs(t, err, errs.InvalidMethodError)
+	for _, name := range []string{"NoContext", "NoError", "ValueRequest", "BadStream"} {
+		assert.ErrorContains(t, err, name)
+	}
+	assert.NotContains(t, err.Error(), "GetById")
+	// nothing is registered
+	_, ok := server.services["invalid-service"]
+	assert.False(t, ok)
+
+	assert.NoError(t, server.RegisterService(&UserService{}))
+	assert.NoError(t, server.RegisterService(&StreamServiceServer{}))
+}
+
+type panicService struct{}
+
+func (p *panicService) Name() string {
+	return "panic-service"
+}
+
+func (p *panicService) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	var m map[int]string
+	m[req.Id] = "boom"
+	return &GetByIdResp{}, nil
+}
+
+func (p *panicService) Chat(ctx context.Context, stream ServerStream) error {
+	panic("boom")
+}
+
+type mockLogger struct {
+	mutex sync.Mutex
+	logs  []string
+}
+
+func (m *mockLogger) Errorf(format string, args ...any) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.logs = append(m.logs, fmt.Sprintf(format, args...))
+}
+
+func TestServer_recover(t *testing.T) {
+	logger := &mockLogger{}
+	mem := transport.NewMemory(0)
+	server := NewServer(ServerWithTransport(mem), ServerWithLogger(logger))
+	require.NoError(t, server.RegisterService(&panicService{}))
+	listener, err := mem.Listen("panic-service")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	client, err := NewClient("panic-service", ClientWithTransport(mem))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+
+	err = client.Call(context.Background(), "panic-service", "GetById", &GetByIdReq{Id: 1}, &GetByIdResp{})
+	assert.Equal(t, status.Internal, status.CodeOf(err))
+	assert.ErrorContains(t, err, errs.MethodPanicked("panic-service", "GetById").Error())
+
+	stream, err := client.Stream(context.Background(), "panic-service", "Chat")
+	require.NoError(t, err)
+	err = stream.Recv(&GetByIdResp{})
+	assert.Equal(t, status.Internal, status.CodeOf(err))
+
+	// the connection survives
+	err = client.Call(context.Background(), "panic-service", "GetById", &GetByIdReq{Id: 2}, &GetByIdResp{})
+	assert.Equal(t, status.Internal, status.CodeOf(err))
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	require.Len(t, logger.logs, 3)
+	// the stack trace is logged instead of sent to the client
+	assert.Contains(t, logger.logs[0], "assignment to entry in nil map")
+	assert.Contains(t, logger.logs[0], "panicService).GetById")
+	assert.NotContains(t, err.Error(), "nil map")
+}
+
+// slowService -> runs until ctx is done, and reports the error of ctx
+type slowService struct {
+	canceled chan error
+}
+
+func (s *slowService) Name() string {
+	return "slow-service"
+}
+
+func (s *slowService) Query(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	select {
+	case <-ctx.Done():
+		s.canceled <- ctx.Err()
+		return nil, ctx.Err()
+	case <-time.After(time.Second * 5):
+		s.canceled <- nil
+		return &GetByIdResp{}, nil
+	}
+}
+
+func TestServer_cancel(t *testing.T) {
+	mem := transport.NewMemory(0)
+	service := &slowService{canceled: make(chan error, 1)}
+	server := NewServer(ServerWithTransport(mem))
+	require.NoError(t, server.RegisterService(service))
+	listener, err := mem.Listen("slow-service")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	client, err := NewClient("slow-service", ClientWithTransport(mem))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+
+	testCases := []struct {
+		name string
+		call func(ctx context.Context) error
+	}{
+		{
+			name: "sync",
+			call: func(ctx context.Context) error {
+				return client.Call(ctx, "slow-service", "Query", &GetByIdReq{}, &GetByIdResp{})
+			},
+		},
+		{
+			name: "async",
+			call: func(ctx context.Context) error {
+				return client.CallAsync(ctx, "slow-service", "Query", &GetByIdReq{}, &GetByIdResp{}).Wait()
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				time.Sleep(time.Millisecond * 100)
+				cancel()
+			}()
+			assert.Equal(t, context.Canceled, tc.call(ctx))
+			select {
+			case err := <-service.canceled:
+				// the method is canceled instead of running to completion
+				assert.Equal(t, context.Canceled, err)
+			case <-time.After(time.Second * 2):
+				t.Fatal("the server is not canceled")
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Error -> framework error with status code
+// Errors produced by the framework, such as unknown method or broken data, are reported as Error.
+// The service method can also return an Error to set the code by itself.
+type Error struct {
+	Code    Code
+	Message string
+	// Details is optional, the service decides how to serialize it
+	Details []byte
+}
+
+func New(code Code, msg string) *Error {
+	return &Error{Code: code, Message: msg}
+}
+
+func Errorf(code Code, format string, args ...any) *Error {
+	return New(code, fmt.Sprintf(format, args...))
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error: code = %s desc = %s", e.Code, e.Message)
+}
+
+// WithDetails -> attach serialized details to the error
+func (e *Error) WithDetails(details []byte) *Error {
+	return &Error{Code: e.Code, Message: e.Message, Details: details}
+}
+
+// BizError -> business error returned by the service method
+// It's transmitted separately from Error, so callers can tell
+// whether the call failed in the framework or in the business logic.
+type BizError struct {
+	Message string
+}
+
+func NewBizError(msg string) *BizError {
+	return &BizError{Message: msg}
+}
+
+func (e *BizError) Error() string {
+	return e.Message
+}
+
+// FromError -> find the Error in the chain of err
+func FromError(err error) (*Error, bool) {
+	var se *Error
+	if errors.As(err, &se) {
+		return se, true
+	}
+	return nil, false
+}
+
+// IsBizError -> whether err is returned by the business logic
+func IsBizError(err error) bool {
+	var be *BizError
+	return errors.As(err, &be)
+}
+
+// CodeOf -> the status code of err
+// nil and business errors are OK from the framework's point of view.
+func CodeOf(err error) Code {
+	if err == nil || IsBizError(err) {
+		return OK
+	}
+	if se, ok := FromError(err); ok {
+		return se.Code
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	default:
+		return Unknown
+	}
+}
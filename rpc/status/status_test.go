@@ -0,0 +1,62 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeOf(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		wantCode Code
+	}{
+		{
+			name:     "nil",
+			wantCode: OK,
+		},
+		{
+			name:     "biz error",
+			err:      NewBizError("user not found"),
+			wantCode: OK,
+		},
+		{
+			name:     "status error",
+			err:      New(Unavailable, "server busy"),
+			wantCode: Unavailable,
+		},
+		{
+			name:     "wrapped status error",
+			err:      fmt.Errorf("call failed: %w", New(InvalidArgument, "bad id")),
+			wantCode: InvalidArgument,
+		},
+		{
+			name:     "deadline",
+			err:      context.DeadlineExceeded,
+			wantCode: DeadlineExceeded,
+		},
+		{
+			name:     "unknown",
+			err:      errors.New("mock error"),
+			wantCode: Unknown,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantCode, CodeOf(tc.err))
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	err := New(NotFound, "no such user").WithDetails([]byte(`{"id":12}`))
+	assert.Equal(t, "rpc error: code = NotFound desc = no such user", err.Error())
+	se, ok := FromError(fmt.Errorf("wrapped: %w", err))
+	assert.True(t, ok)
+	assert.Equal(t, []byte(`{"id":12}`), se.Details)
+	assert.Equal(t, "Code(100)", Code(100).String())
+}
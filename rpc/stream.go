@@ -0,0 +1,434 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"emicro/rpc/compress"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/serialize"
+	"io"
+	"reflect"
+	"sync"
+)
+
+var (
+	clientStreamType = reflect.TypeOf((*ClientStream)(nil)).Elem()
+	serverStreamType = reflect.TypeOf((*ServerStream)(nil)).Elem()
+)
+
+// ClientStream -> the client side of a streaming call
+// Send and Recv can be called from two goroutines at the same time,
+// but it's not safe to call Send (or Recv) on the same stream in different goroutines.
+type ClientStream interface {
+	// Context returns the context of the call, cancelling it resets the stream
+	Context() context.Context
+	// Send sends a message to the server.
+	// It returns io.EOF if the stream has been terminated, use Recv to get the reason.
+	Send(m any) error
+	// Recv receives a message from the server.
+	// It returns io.EOF when the server finishes the stream successfully.
+	Recv(m any) error
+	// CloseSend tells the server that no more messages will be sent
+	CloseSend() error
+}
+
+// ServerStream -> the server side of a streaming call
+type ServerStream interface {
+	Context() context.Context
+	// Send sends a message to the client
+	Send(m any) error
+	// Recv receives a message from the client.
+	// It returns io.EOF after the client calls CloseSend.
+	Recv(m any) error
+}
+
+// streamWindow -> the number of messages a stream can send before the peer consumes them
+// The receiver grants the consumed messages back once half of the window is consumed,
+// so a slow reader buffers at most streamWindow messages of a stream.
+const streamWindow = 64
+
+// streamBuffer -> bounded buffer of the frames received by a stream
+// The reader goroutine of the connection must never block on a slow stream,
+// otherwise all calls on the same connection would be blocked.
+// The sender respects the window instead, a full buffer means the peer violates it.
+type streamBuffer[T any] struct {
+	mutex sync.Mutex
+	items []T
+	limit int
+	// terminal error, returned after all items are consumed
+	err    error
+	notify chan struct{}
+}
+
+func newStreamBuffer[T any](limit int) *streamBuffer[T] {
+	return &streamBuffer[T]{
+		limit:  limit,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// put -> false if the buffer is full, the items after close are dropped
+func (b *streamBuffer[T]) put(item T) bool {
+	b.mutex.Lock()
+	if b.err == nil {
+		if len(b.items) >= b.limit {
+			b.mutex.Unlock()
+			return false
+		}
+		b.items = append(b.items, item)
+	}
+	b.mutex.Unlock()
+	b.wakeup()
+	return true
+}
+
+// close -> no more items, the first error wins
+func (b *streamBuffer[T]) close(err error) {
+	b.mutex.Lock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.mutex.Unlock()
+	b.wakeup()
+}
+
+func (b *streamBuffer[T]) wakeup() {
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (b *streamBuffer[T]) get(ctx context.Context) (T, error) {
+	for {
+		b.mutex.Lock()
+		if len(b.items) > 0 {
+			item := b.items[0]
+			b.items = b.items[1:]
+			b.mutex.Unlock()
+			return item, nil
+		}
+		err := b.err
+		b.mutex.Unlock()
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		case <-b.notify:
+		}
+	}
+}
+
+// sendWindow -> the credits of a stream to send messages, granted back by the peer
+type sendWindow struct {
+	mutex   sync.Mutex
+	credits int
+	notify  chan struct{}
+}
+
+func newSendWindow() *sendWindow {
+	return &sendWindow{
+		credits: streamWindow,
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// acquire -> take a credit, block until the peer grants more, ctx is done or the stream is finished
+func (w *sendWindow) acquire(ctx context.Context, done <-chan struct{}) error {
+	for {
+		w.mutex.Lock()
+		if w.credits > 0 {
+			w.credits--
+			w.mutex.Unlock()
+			return nil
+		}
+		w.mutex.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-done:
+			return io.EOF
+		case <-w.notify:
+		}
+	}
+}
+
+func (w *sendWindow) grant(credits uint32) {
+	w.mutex.Lock()
+	w.credits += int(credits)
+	w.mutex.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+var _ ClientStream = (*clientStream)(nil)
+
+// clientStream -> ClientStream on a multiplexed connection
+type clientStream struct {
+	ctx        context.Context
+	conn       *clientConn
+	id         uint32
+	open       *message2.Request
+	serializer serialize.Serializer
+	compressor compress.Compressor
+	buffer     *streamBuffer[*message2.Response]
+	window     *sendWindow
+	// the messages received but not granted back to the server yet
+	consumed int
+
+	once sync.Once
+	// closed when the stream is finished
+	done chan struct{}
+	// called once when the stream is finished, nil is allowed
+	onFinish func(err error)
+}
+
+func (s *clientStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *clientStream) Send(m any) error {
+	select {
+	case <-s.done:
+		return io.EOF
+	default:
+	}
+	data, err := s.serializer.Encode(m)
+	if err != nil {
+		return err
+	}
+	data, err = s.compressor.Compress(data)
+	if err != nil {
+		return err
+	}
+	if err = s.window.acquire(s.ctx, s.done); err != nil {
+		return err
+	}
+	return s.writeFrame(message2.MessageTypeStreamData, data)
+}
+
+func (s *clientStream) Recv(m any) error {
+	resp, err := s.buffer.get(s.ctx)
+	if err != nil {
+		return err
+	}
+	s.consume()
+	data, err := s.compressor.UnCompress(resp.Data)
+	if err != nil {
+		return err
+	}
+	return s.serializer.Decode(data, m)
+}
+
+func (s *clientStream) CloseSend() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+	return s.writeFrame(message2.MessageTypeStreamHalfClose, nil)
+}
+
+// consume -> grant the consumed messages back once half of the window is consumed
+func (s *clientStream) consume() {
+	if s.consumed++; s.consumed < streamWindow/2 {
+		return
+	}
+	select {
+	case <-s.done:
+		// the server has finished sending
+		return
+	default:
+	}
+	credits := uint32(s.consumed)
+	s.consumed = 0
+	_ = s.writeFrame(message2.MessageTypeStreamWindowUpdate, message2.EncodeWindowUpdate(credits))
+}
+
+func (s *clientStream) writeFrame(typ uint8, data []byte) error {
+	req := &message2.Request{
+		Version:     s.open.Version,
+		Compresser:  s.open.Compresser,
+		Serializer:  s.open.Serializer,
+		MessageId:   s.id,
+		MessageType: typ,
+		Data:        data,
+	}
+	req.CalculateHeaderLength()
+	req.CalculateBodyLength()
+	return s.conn.write(req)
+}
+
+// watch -> reset the stream when the context is cancelled
+func (s *clientStream) watch() {
+	select {
+	case <-s.done:
+	case <-s.ctx.Done():
+		s.reset(s.ctx.Err())
+	}
+}
+
+// reset -> give up the stream, the server does not need to run it anymore
+func (s *clientStream) reset(err error) {
+	_ = s.writeFrame(message2.MessageTypeStreamReset, nil)
+	s.conn.removeStream(s.id)
+	s.finish(err)
+}
+
+// handle -> called by the reader goroutine of the connection
+func (s *clientStream) handle(resp *message2.Response) {
+	switch resp.MessageType {
+	case message2.MessageTypeStreamData:
+		if !s.buffer.put(resp) {
+			s.abort(errs.StreamWindowError)
+		}
+	case message2.MessageTypeStreamWindowUpdate:
+		credits, err := message2.DecodeWindowUpdate(resp.Data)
+		if err != nil {
+			s.abort(err)
+			return
+		}
+		s.window.grant(credits)
+	case message2.MessageTypeStreamHalfClose:
+		// the server finishes the stream with the result of the method
+		err := responseError(resp)
+		if err == nil {
+			err = io.EOF
+		}
+		s.finish(err)
+	case message2.MessageTypeStreamReset:
+		s.finish(errs.StreamReset(string(resp.Error)))
+	}
+}
+
+// abort -> the server violates the protocol, reset the stream
+// The reset frame is written in a new goroutine, the reader goroutine must not block on writing.
+func (s *clientStream) abort(err error) {
+	s.conn.removeStream(s.id)
+	s.finish(err)
+	go func() {
+		_ = s.writeFrame(message2.MessageTypeStreamReset, nil)
+	}()
+}
+
+func (s *clientStream) finish(err error) {
+	s.once.Do(func() {
+		s.buffer.close(err)
+		close(s.done)
+		if s.onFinish != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			s.onFinish(err)
+		}
+	})
+}
+
+var _ ServerStream = (*serverStream)(nil)
+
+// serverStream -> ServerStream on a multiplexed connection
+type serverStream struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	conn       *serverConn
+	open       *message2.Request
+	serializer serialize.Serializer
+	compressor compress.Compressor
+	buffer     *streamBuffer[*message2.Request]
+	window     *sendWindow
+	// the messages received but not granted back to the client yet
+	consumed int
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) Send(m any) error {
+	if s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+	data, err := s.serializer.Encode(m)
+	if err != nil {
+		return err
+	}
+	data, err = s.compressor.Compress(data)
+	if err != nil {
+		return err
+	}
+	if err = s.window.acquire(s.ctx, nil); err != nil {
+		return err
+	}
+	return s.conn.writeResp(s.newResponse(message2.MessageTypeStreamData, data, nil))
+}
+
+func (s *serverStream) Recv(m any) error {
+	req, err := s.buffer.get(s.ctx)
+	if err != nil {
+		return err
+	}
+	s.consume()
+	data, err := s.compressor.UnCompress(req.Data)
+	if err != nil {
+		return err
+	}
+	return s.serializer.Decode(data, m)
+}
+
+// consume -> grant the consumed messages back once half of the window is consumed
+func (s *serverStream) consume() {
+	if s.consumed++; s.consumed < streamWindow/2 {
+		return
+	}
+	credits := uint32(s.consumed)
+	s.consumed = 0
+	_ = s.conn.writeResp(s.newResponse(message2.MessageTypeStreamWindowUpdate, message2.EncodeWindowUpdate(credits), nil))
+}
+
+func (s *serverStream) newResponse(typ uint8, data []byte, err error) *message2.Response {
+	resp := &message2.Response{
+		Version:     s.open.Version,
+		Compresser:  s.open.Compresser,
+		Serializer:  s.open.Serializer,
+		MessageId:   s.open.MessageId,
+		MessageType: typ,
+		Data:        data,
+	}
+	setResponseError(resp, err)
+	return resp
+}
+
+// handle -> called by the reader goroutine of the connection
+func (s *serverStream) handle(req *message2.Request) {
+	switch req.MessageType {
+	case message2.MessageTypeStreamData:
+		if !s.buffer.put(req) {
+			s.abort(errs.StreamWindowError)
+		}
+	case message2.MessageTypeStreamWindowUpdate:
+		credits, err := message2.DecodeWindowUpdate(req.Data)
+		if err != nil {
+			s.abort(err)
+			return
+		}
+		s.window.grant(credits)
+	case message2.MessageTypeStreamHalfClose:
+		s.buffer.close(io.EOF)
+	case message2.MessageTypeStreamReset:
+		// the client gives up, stop the method as soon as possible
+		s.cancel()
+		s.buffer.close(context.Canceled)
+	}
+}
+
+// abort -> the client violates the protocol, stop the method with the error
+func (s *serverStream) abort(err error) {
+	s.cancel()
+	s.buffer.close(err)
+}
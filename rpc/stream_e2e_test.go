@@ -0,0 +1,297 @@
+package rpc
+
+import (
+	"context"
+	"emicro/rpc/compress/gzip"
+	"emicro/rpc/compress/snappy"
+	"emicro/rpc/status"
+	"emicro/rpc/transport"
+	"errors"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	server := NewServer()
+	service := &StreamServiceServer{}
+	err := server.RegisterService(service)
+	require.NoError(t, err)
+	go func() {
+		err := server.Start(":8081")
+		t.Log(err)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	time.Sleep(time.Second * 3)
+
+	client, err := NewClient(":8081")
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	usClient := &StreamServiceClient{}
+	err = client.InitService(usClient)
+	require.NoError(t, err)
+
+	t.Run("server streaming", func(t *testing.T) {
+		stream, err := usClient.ListUsers(context.Background(), &GetByIdReq{Id: 3})
+		require.NoError(t, err)
+		var msgs []string
+		for {
+			resp := &GetByIdResp{}
+			err = stream.Recv(resp)
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			msgs = append(msgs, resp.Msg)
+		}
+		assert.Equal(t, []string{"user-0", "user-1", "user-2"}, msgs)
+	})
+
+	t.Run("server streaming error", func(t *testing.T) {
+		stream, err := usClient.ListUsers(context.Background(), &GetByIdReq{Id: -1})
+		require.NoError(t, err)
+		err = stream.Recv(&GetByIdResp{})
+		assert.Equal(t, status.NewBizError("invalid id"), err)
+	})
+
+	t.Run("client streaming", func(t *testing.T) {
+		stream, err := usClient.Sum(context.Background())
+		require.NoError(t, err)
+		for i := 1; i <= 4; i++ {
+			require.NoError(t, stream.Send(&GetByIdReq{Id: i}))
+		}
+		require.NoError(t, stream.CloseSend())
+		resp := &GetByIdResp{}
+		require.NoError(t, stream.Recv(resp))
+		assert.Equal(t, "10", resp.Msg)
+		assert.Equal(t, io.EOF, stream.Recv(resp))
+	})
+
+	t.Run("bidirectional streaming", func(t *testing.T) {
+		stream, err := usClient.Echo(context.Background())
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, stream.Send(&GetByIdReq{Id: i}))
+			resp := &GetByIdResp{}
+			require.NoError(t, stream.Recv(resp))
+			assert.Equal(t, GetByIdResp{Msg: "echo"}, *resp)
+		}
+		require.NoError(t, stream.CloseSend())
+		assert.Equal(t, io.EOF, stream.Recv(&GetByIdResp{}))
+	})
+
+	t.Run("flow control", func(t *testing.T) {
+		const total = streamWindow * 10
+		stream, err := usClient.ListUsers(context.Background(), &GetByIdReq{Id: total})
+		require.NoError(t, err)
+		// the server stops sending when the window is used up
+		buffer := stream.(*clientStream).buffer
+		buffered := func() int {
+			buffer.mutex.Lock()
+			defer buffer.mutex.Unlock()
+			return len(buffer.items)
+		}
+		assert.Eventually(t, func() bool {
+			return buffered() == streamWindow
+		}, time.Second, time.Millisecond*10)
+		time.Sleep(time.Millisecond * 100)
+		assert.Equal(t, streamWindow, buffered())
+
+		// all messages are delivered after the client consumes them
+		n := 0
+		for {
+			err = stream.Recv(&GetByIdResp{})
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			assert.LessOrEqual(t, buffered(), streamWindow)
+			n++
+		}
+		assert.Equal(t, total, n)
+
+		// the client waits for the credits granted by the server in the same way
+		sum, err := usClient.Sum(context.Background())
+		require.NoError(t, err)
+		for i := 1; i <= total; i++ {
+			require.NoError(t, sum.Send(&GetByIdReq{Id: 1}))
+		}
+		require.NoError(t, sum.CloseSend())
+		resp := &GetByIdResp{}
+		require.NoError(t, sum.Recv(resp))
+		assert.Equal(t, strconv.Itoa(total), resp.Msg)
+	})
+
+	t.Run("request fails to encode", func(t *testing.T) {
+		badClient := &badStreamClient{}
+		require.NoError(t, client.InitService(badClient))
+		// json can not encode a channel
+		_, err := badClient.ListUsers(context.Background(), make(chan int))
+		assert.Error(t, err)
+		// the stream is reset instead of staying open on the connection
+		client.connPool.mutex.Lock()
+		defer client.connPool.mutex.Unlock()
+		for _, conn := range client.connPool.conns {
+			conn.mutex.Lock()
+			assert.Empty(t, conn.streams)
+			conn.mutex.Unlock()
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := usClient.Echo(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&GetByIdReq{Id: 1}))
+		require.NoError(t, stream.Recv(&GetByIdResp{}))
+		cancel()
+		assert.Equal(t, context.Canceled, stream.Recv(&GetByIdResp{}))
+		// the server observes the cancellation
+		assert.Eventually(t, func() bool {
+			return atomic.LoadInt32(&service.cancelled) == 1
+		}, time.Second, time.Millisecond*10)
+	})
+}
+
+func TestStream_CodecsInCtx(t *testing.T) {
+	mem := transport.NewMemory(0)
+	server := NewServer(ServerWithTransport(mem))
+	server.RegisterCompressor(gzip.Compressor{})
+	require.NoError(t, server.RegisterService(&StreamServiceServer{}))
+	listener, err := mem.Listen("stream-service")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	client, err := NewClient("stream-service", ClientWithTransport(mem))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	usClient := &StreamServiceClient{}
+	require.NoError(t, client.InitService(usClient))
+
+	t.Run("server streaming", func(t *testing.T) {
+		ctx := CtxWithCompressor(context.Background(), gzip.Compressor{})
+		stream, err := usClient.ListUsers(ctx, &GetByIdReq{Id: 2})
+		require.NoError(t, err)
+		assert.Equal(t, gzip.Compressor{}.Code(), stream.(*clientStream).open.Compresser)
+		var msgs []string
+		for {
+			resp := &GetByIdResp{}
+			err = stream.Recv(resp)
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			msgs = append(msgs, resp.Msg)
+		}
+		assert.Equal(t, []string{"user-0", "user-1"}, msgs)
+	})
+
+	t.Run("client streaming", func(t *testing.T) {
+		ctx := CtxWithCompressor(context.Background(), gzip.Compressor{})
+		stream, err := usClient.Sum(ctx)
+		require.NoError(t, err)
+		for i := 1; i <= 3; i++ {
+			require.NoError(t, stream.Send(&GetByIdReq{Id: i}))
+		}
+		require.NoError(t, stream.CloseSend())
+		resp := &GetByIdResp{}
+		require.NoError(t, stream.Recv(resp))
+		assert.Equal(t, "6", resp.Msg)
+	})
+
+	t.Run("compressor not registered", func(t *testing.T) {
+		ctx := CtxWithCompressor(context.Background(), snappy.Compressor{})
+		stream, err := usClient.ListUsers(ctx, &GetByIdReq{Id: 2})
+		require.NoError(t, err)
+		err = stream.Recv(&GetByIdResp{})
+		assertStatus(t, status.New(status.Unimplemented, "emicro: unsupported serializer 1 or compressor 2"), err)
+	})
+}
+
+type StreamServiceClient struct {
+	ListUsers func(ctx context.Context, req *GetByIdReq) (ClientStream, error)
+	Sum       func(ctx context.Context) (ClientStream, error)
+	Echo      func(ctx context.Context) (ClientStream, error)
+}
+
+func (s *StreamServiceClient) Name() string {
+	return "stream-service"
+}
+
+// badStreamClient -> its requests are sent as they are
+type badStreamClient struct {
+	ListUsers func(ctx context.Context, req any) (ClientStream, error)
+}
+
+func (s *badStreamClient) Name() string {
+	return "stream-service"
+}
+
+type StreamServiceServer struct {
+	cancelled int32
+}
+
+func (s *StreamServiceServer) Name() string {
+	return "stream-service"
+}
+
+func (s *StreamServiceServer) ListUsers(ctx context.Context, req *GetByIdReq, stream ServerStream) error {
+	if req.Id < 0 {
+		return errors.New("invalid id")
+	}
+	for i := 0; i < req.Id; i++ {
+		if err := stream.Send(&GetByIdResp{Msg: "user-" + strconv.Itoa(i)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StreamServiceServer) Sum(ctx context.Context, stream ServerStream) (*GetByIdResp, error) {
+	sum := 0
+	for {
+		req := &GetByIdReq{}
+		err := stream.Recv(req)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		sum += req.Id
+	}
+	return &GetByIdResp{Msg: strconv.Itoa(sum)}, nil
+}
+
+func (s *StreamServiceServer) Echo(ctx context.Context, stream ServerStream) error {
+	for {
+		err := stream.Recv(&GetByIdReq{})
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				atomic.StoreInt32(&s.cancelled, 1)
+			}
+			return err
+		}
+		if err = stream.Send(&GetByIdResp{Msg: "echo"}); err != nil {
+			return err
+		}
+	}
+}
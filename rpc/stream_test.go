@@ -0,0 +1,111 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamBuffer(t *testing.T) {
+	testCases := []struct {
+		name      string
+		ctx       func() (context.Context, context.CancelFunc)
+		items     []int
+		closeErr  error
+		wantItems []int
+		wantErr   error
+	}{
+		{
+			name: "items then error",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			items:     []int{1, 2, 3},
+			closeErr:  io.EOF,
+			wantItems: []int{1, 2, 3},
+			wantErr:   io.EOF,
+		},
+		{
+			name: "first error wins",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			closeErr: errors.New("mock error"),
+			wantErr:  errors.New("mock error"),
+		},
+		{
+			name: "timeout",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Millisecond*100)
+			},
+			items:     []int{1},
+			wantItems: []int{1},
+			wantErr:   context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := tc.ctx()
+			defer cancel()
+			b := newStreamBuffer[int](streamWindow)
+			go func() {
+				for _, item := range tc.items {
+					b.put(item)
+				}
+				if tc.closeErr != nil {
+					b.close(tc.closeErr)
+					b.close(errors.New("ignored error"))
+				}
+			}()
+			var items []int
+			for {
+				item, err := b.get(ctx)
+				if err != nil {
+					assert.Equal(t, tc.wantErr, err)
+					break
+				}
+				items = append(items, item)
+			}
+			assert.Equal(t, tc.wantItems, items)
+		})
+	}
+}
+
+func TestStreamBuffer_Full(t *testing.T) {
+	b := newStreamBuffer[int](2)
+	assert.True(t, b.put(1))
+	assert.True(t, b.put(2))
+	// the peer ignores the window
+	assert.False(t, b.put(3))
+	item, err := b.get(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, item)
+	assert.True(t, b.put(3))
+
+	// the items after close are dropped
+	b.close(io.EOF)
+	assert.True(t, b.put(4))
+	assert.Len(t, b.items, 2)
+}
+
+func TestSendWindow(t *testing.T) {
+	w := newSendWindow()
+	for i := 0; i < streamWindow; i++ {
+		assert.NoError(t, w.acquire(context.Background(), nil))
+	}
+	// no credits left
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, w.acquire(ctx, nil))
+	done := make(chan struct{})
+	close(done)
+	assert.Equal(t, io.EOF, w.acquire(context.Background(), done))
+
+	// the peer grants credits back
+	go w.grant(1)
+	assert.NoError(t, w.acquire(context.Background(), nil))
+}
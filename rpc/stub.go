@@ -0,0 +1,129 @@
+package rpc
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"emicro/rpc/compress"
+	message2 "emicro/rpc/message"
+	"emicro/rpc/serialize"
+	"emicro/rpc/status"
+)
+
+// stub -> dispatch the requests of a service to its implementation
+// reflectionStub is used by RegisterService, descStub by RegisterServiceDesc.
+type stub interface {
+	Invoke(ctx context.Context, req *message2.Request) *message2.Response
+	InvokeStream(stream *serverStream) error
+	// describe -> the methods for the reflection service, sorted by name
+	describe() []MethodInfo
+}
+
+// MethodHandler -> generated handler of a unary method
+// dec decodes the request data into the argument of the method.
+type MethodHandler func(srv any, ctx context.Context, dec func(in any) error) (any, error)
+
+// StreamHandler -> generated handler of a streaming method
+type StreamHandler func(srv any, stream ServerStream) error
+
+// ServiceDesc -> generated dispatch table of a service, see cmd/rpcgen
+type ServiceDesc struct {
+	ServiceName string
+	Methods     map[string]MethodHandler
+	Streams     map[string]StreamHandler
+}
+
+var _ stub = (*descStub)(nil)
+
+// descStub -> stub calling the generated handlers, no reflection is needed
+type descStub struct {
+	desc        *ServiceDesc
+	impl        any
+	serializers []serialize.Serializer
+	compressors []compress.Compressor
+}
+
+func (s *descStub) Invoke(ctx context.Context, req *message2.Request) *message2.Response {
+	response := newStubResponse(req)
+	handler, ok := s.desc.Methods[req.MethodName]
+	if !ok {
+		setResponseError(response, status.New(status.Unimplemented, errs.NotFoundServiceMethod(req.MethodName).Error()))
+		return response
+	}
+	codecs, err := negotiate(req, response, s.serializers, s.compressors)
+	if err != nil {
+		setResponseError(response, err)
+		return response
+	}
+	out, err := handler(s.impl, ctx, func(in any) error {
+		return decodeRequest(req, codecs.reqSerializer, codecs.reqCompressor, in)
+	})
+	if err != nil {
+		setResponseError(response, err)
+	}
+	// the generated handler returns nil instead of a typed nil pointer
+	if out != nil {
+		encodeResponse(response, codecs.respSerializer, codecs.respCompressor, out)
+	}
+	return response
+}
+
+func (s *descStub) InvokeStream(stream *serverStream) error {
+	handler, ok := s.desc.Streams[stream.open.MethodName]
+	if !ok {
+		return status.New(status.Unimplemented, errs.NotFoundServiceMethod(stream.open.MethodName).Error())
+	}
+	return handler(s.impl, stream)
+}
+
+// describe -> the generated handlers don't expose the types of the methods
+func (s *descStub) describe() []MethodInfo {
+	methods := make([]MethodInfo, 0, len(s.desc.Methods)+len(s.desc.Streams))
+	for name := range s.desc.Methods {
+		methods = append(methods, MethodInfo{Name: name, Kind: MethodKindUnary})
+	}
+	for name := range s.desc.Streams {
+		methods = append(methods, MethodInfo{Name: name, Kind: MethodKindStreaming})
+	}
+	return sortMethods(methods)
+}
+
+func newStubResponse(req *message2.Request) *message2.Response {
+	return &message2.Response{
+		Version: req.Version,
+		// the same codecs as the request unless the client accepts others, see negotiate
+		Compresser: req.Compresser,
+		Serializer: req.Serializer,
+		MessageId:  req.MessageId,
+	}
+}
+
+// decodeRequest -> decompress and deserialize the request data,
+// the error is InvalidArgument because the client sent bad data
+func decodeRequest(req *message2.Request, serializer serialize.Serializer,
+	compressor compress.Compressor, in any) error {
+	data, err := compressor.UnCompress(req.Data)
+	if err != nil {
+		return status.New(status.InvalidArgument, err.Error())
+	}
+	if err = serializer.Decode(data, in); err != nil {
+		return status.New(status.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+// encodeResponse -> serialize and compress out as the response data
+func encodeResponse(response *message2.Response, serializer serialize.Serializer,
+	compressor compress.Compressor, out any) {
+	data, err := serializer.Encode(out)
+	if err != nil {
+		// server error
+		setResponseError(response, status.New(status.Internal, err.Error()))
+		return
+	}
+	data, err = compressor.Compress(data)
+	if err != nil {
+		setResponseError(response, status.New(status.Internal, err.Error()))
+		return
+	}
+	response.Data = data
+}
@@ -1,10 +1,54 @@
 package tcp
 
-import "net"
+import (
+	"emicro/internal/errs"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+)
 
-// TODO(Protocol, Header)
+// lenBytes 长度字段占用的字节数：HeadLength 四个字节 + BodyLength 四个字节
 const lenBytes = 8
 
+// DefaultMaxFrameSize 默认允许的最大帧长度，4MB
+const DefaultMaxFrameSize uint32 = 4 << 20
+
+// ReadMsg reads a complete frame using DefaultMaxFrameSize
 func ReadMsg(conn net.Conn) (bs []byte, err error) {
-	panic("")
+	return ReadMsgWithLimit(conn, DefaultMaxFrameSize)
+}
+
+// ReadMsgWithLimit reads a complete frame from conn.
+// The frame starts with the 8-byte HeadLength/BodyLength prefix written by
+// message.EncodeReq and message.EncodeResp, and the returned slice contains
+// the whole frame including the prefix.
+// If the peer closes the connection before any byte of the frame is read, io.EOF is returned.
+func ReadMsgWithLimit(conn net.Conn, maxSize uint32) (bs []byte, err error) {
+	lenBs := make([]byte, lenBytes)
+	if _, err = io.ReadFull(conn, lenBs); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errs.FrameTruncatedError
+		}
+		return nil, err
+	}
+	headLength := binary.BigEndian.Uint32(lenBs[:4])
+	bodyLength := binary.BigEndian.Uint32(lenBs[4:])
+	// 使用 uint64 计算，避免两个 uint32 相加溢出
+	size := uint64(headLength) + uint64(bodyLength)
+	if size < lenBytes {
+		return nil, errs.InvalidFrameLength(size)
+	}
+	if size > uint64(maxSize) {
+		return nil, errs.FrameTooLarge(size, maxSize)
+	}
+	bs = make([]byte, size)
+	copy(bs, lenBs)
+	if _, err = io.ReadFull(conn, bs[lenBytes:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errs.FrameTruncatedError
+		}
+		return nil, err
+	}
+	return bs, nil
 }
@@ -0,0 +1,115 @@
+package tcp
+
+import (
+	"bytes"
+	"emicro/internal/errs"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadMsgWithLimit(t *testing.T) {
+	testCases := []struct {
+		name    string
+		data    []byte
+		maxSize uint32
+		wantBs  []byte
+		wantErr error
+	}{
+		{
+			name:    "eof",
+			data:    []byte{},
+			maxSize: DefaultMaxFrameSize,
+			wantErr: io.EOF,
+		},
+		{
+			name:    "truncated length",
+			data:    []byte{0, 0, 0},
+			maxSize: DefaultMaxFrameSize,
+			wantErr: errs.FrameTruncatedError,
+		},
+		{
+			name:    "truncated body",
+			data:    newFrame(10, 5)[:12],
+			maxSize: DefaultMaxFrameSize,
+			wantErr: errs.FrameTruncatedError,
+		},
+		{
+			name:    "too large",
+			data:    newFrame(10, 5),
+			maxSize: 14,
+			wantErr: errs.FrameTooLarge(15, 14),
+		},
+		{
+			name:    "invalid length",
+			data:    []byte{0, 0, 0, 3, 0, 0, 0, 2},
+			maxSize: DefaultMaxFrameSize,
+			wantErr: errs.InvalidFrameLength(5),
+		},
+		{
+			name:    "normal",
+			data:    newFrame(10, 5),
+			maxSize: DefaultMaxFrameSize,
+			wantBs:  newFrame(10, 5),
+		},
+		{
+			name:    "only first frame",
+			data:    append(newFrame(10, 5), newFrame(12, 0)...),
+			maxSize: DefaultMaxFrameSize,
+			wantBs:  newFrame(10, 5),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := &mockConn{r: bytes.NewReader(tc.data)}
+			bs, err := ReadMsgWithLimit(conn, tc.maxSize)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantBs, bs)
+		})
+	}
+}
+
+func TestWriteMsg(t *testing.T) {
+	conn := &mockConn{w: &bytes.Buffer{}, maxWrite: 3}
+	frame := newFrame(10, 5)
+	err := WriteMsg(conn, frame)
+	assert.NoError(t, err)
+	assert.Equal(t, frame, conn.w.Bytes())
+
+	conn = &mockConn{w: &bytes.Buffer{}}
+	err = WriteMsg(conn, frame)
+	assert.Equal(t, io.ErrShortWrite, err)
+}
+
+// newFrame builds a frame whose header and body are filled with their index
+func newFrame(headLength, bodyLength uint32) []byte {
+	bs := make([]byte, headLength+bodyLength)
+	binary.BigEndian.PutUint32(bs[:4], headLength)
+	binary.BigEndian.PutUint32(bs[4:8], bodyLength)
+	for i := lenBytes; i < len(bs); i++ {
+		bs[i] = byte(i)
+	}
+	return bs
+}
+
+type mockConn struct {
+	net.Conn
+	r *bytes.Reader
+	w *bytes.Buffer
+	// the maximum number of bytes written by one Write call
+	maxWrite int
+}
+
+func (m *mockConn) Read(bs []byte) (int, error) {
+	return m.r.Read(bs)
+}
+
+func (m *mockConn) Write(bs []byte) (int, error) {
+	if len(bs) > m.maxWrite {
+		bs = bs[:m.maxWrite]
+	}
+	return m.w.Write(bs)
+}
@@ -0,0 +1,36 @@
+package tcp
+
+import (
+	"io"
+	"net"
+)
+
+// WriteMsg writes the whole frame to conn.
+// net.Conn may return after a partial write, so we keep writing until
+// all data is written or an error occurs.
+func WriteMsg(conn net.Conn, bs []byte) error {
+	for len(bs) > 0 {
+		n, err := conn.Write(bs)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+		bs = bs[n:]
+	}
+	return nil
+}
+
+// WriteBuffers writes the frame whose header and body are in separate slices,
+// so that the caller doesn't need to concatenate them.
+// The TCP connection writes them by a single writev system call.
+func WriteBuffers(conn net.Conn, header, body []byte) error {
+	if len(body) == 0 {
+		// some connections, e.g. net.Pipe, block on an empty write until the peer reads
+		return WriteMsg(conn, header)
+	}
+	buffers := net.Buffers{header, body}
+	_, err := buffers.WriteTo(conn)
+	return err
+}
@@ -0,0 +1,37 @@
+package tcp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteBuffers(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() {
+		_ = server.Close()
+	}()
+	go func() {
+		_ = WriteBuffers(client, newFrame(6, 5)[:10], newFrame(6, 5)[10:])
+		_ = client.Close()
+	}()
+	bs, err := ReadMsgWithLimit(server, DefaultMaxFrameSize)
+	require.NoError(t, err)
+	assert.Equal(t, newFrame(6, 5), bs)
+}
+
+func TestWriteBuffers_emptyBody(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() {
+		_ = server.Close()
+	}()
+	go func() {
+		_ = WriteBuffers(client, newFrame(10, 0), nil)
+		_ = client.Close()
+	}()
+	bs, err := ReadMsgWithLimit(server, DefaultMaxFrameSize)
+	require.NoError(t, err)
+	assert.Equal(t, newFrame(10, 0), bs)
+}
@@ -0,0 +1,45 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// tlsClient -> run the TLS handshake on the client side
+// ServerName is the host of address if it's not set in config.
+func tlsClient(ctx context.Context, conn net.Conn, address string, config *tls.Config) (net.Conn, error) {
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+	tc := tls.Client(conn, config)
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// newPeer -> run the TLS handshake on the server side if it's a TLS connection,
+// so the client certificate is verified before any request is read
+func newPeer(conn net.Conn) (*Peer, error) {
+	p := &Peer{Addr: conn.RemoteAddr()}
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return p, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	state := tc.ConnectionState()
+	p.TLS = &state
+	return p, nil
+}
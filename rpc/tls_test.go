@@ -0,0 +1,203 @@
+package rpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// peerService -> returns the identity of the client
+type peerService struct{}
+
+func (p *peerService) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	peer, ok := PeerFromContext(ctx)
+	if !ok || peer.TLS == nil {
+		return &GetByIdResp{Msg: "plain"}, nil
+	}
+	if cert := peer.Certificate(); cert != nil {
+		return &GetByIdResp{Msg: cert.Subject.CommonName}, nil
+	}
+	return &GetByIdResp{Msg: "anonymous"}, nil
+}
+
+func (p *peerService) Name() string {
+	return "user-service"
+}
+
+// testCA -> self-signed CA generated at runtime
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "emicro test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCert := ca.issue(t, "order-service", x509.ExtKeyUsageClientAuth)
+	// the client certificate is not issued by ca
+	otherCert := newTestCA(t).issue(t, "hacker", x509.ExtKeyUsageClientAuth)
+
+	testCases := []struct {
+		name         string
+		addr         string
+		serverConfig *tls.Config
+		clientConfig *tls.Config
+
+		wantMsg string
+		wantErr bool
+	}{
+		{
+			name:         "tls",
+			addr:         "127.0.0.1:8087",
+			serverConfig: &tls.Config{Certificates: []tls.Certificate{serverCert}},
+			clientConfig: &tls.Config{RootCAs: ca.pool},
+			wantMsg:      "anonymous",
+		},
+		{
+			name: "mutual tls",
+			addr: "localhost:8088",
+			serverConfig: &tls.Config{
+				Certificates: []tls.Certificate{serverCert},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    ca.pool,
+			},
+			clientConfig: &tls.Config{RootCAs: ca.pool, Certificates: []tls.Certificate{clientCert}},
+			wantMsg:      "order-service",
+		},
+		{
+			name: "no client certificate",
+			addr: "127.0.0.1:8089",
+			serverConfig: &tls.Config{
+				Certificates: []tls.Certificate{serverCert},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    ca.pool,
+			},
+			clientConfig: &tls.Config{RootCAs: ca.pool},
+			wantErr:      true,
+		},
+		{
+			name: "untrusted client certificate",
+			addr: "127.0.0.1:8090",
+			serverConfig: &tls.Config{
+				Certificates: []tls.Certificate{serverCert},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    ca.pool,
+			},
+			clientConfig: &tls.Config{RootCAs: ca.pool, Certificates: []tls.Certificate{otherCert}},
+			wantErr:      true,
+		},
+		{
+			name:         "untrusted server",
+			addr:         "127.0.0.1:8091",
+			serverConfig: &tls.Config{Certificates: []tls.Certificate{serverCert}},
+			clientConfig: &tls.Config{},
+			wantErr:      true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer(ServerWithTLS(tc.serverConfig))
+			_ = server.RegisterService(&peerService{})
+			go func() {
+				err := server.Start(tc.addr)
+				t.Log(err)
+			}()
+			defer func() {
+				_ = server.Close()
+			}()
+			time.Sleep(time.Second)
+
+			client, err := NewClient(tc.addr, ClientWithTLS(tc.clientConfig))
+			require.NoError(t, err)
+			defer func() {
+				_ = client.Close()
+			}()
+			usClient := &UserServiceClient{}
+			require.NoError(t, client.InitService(usClient))
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+			resp, err := usClient.GetById(ctx, &GetByIdReq{Id: 123})
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantMsg, resp.Msg)
+		})
+	}
+}
+
+func TestPeer_plain(t *testing.T) {
+	server := NewServer()
+	_ = server.RegisterService(&peerService{})
+	go func() {
+		err := server.Start("127.0.0.1:8092")
+		t.Log(err)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+	time.Sleep(time.Second)
+
+	client, err := NewClient("127.0.0.1:8092")
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	usClient := &UserServiceClient{}
+	require.NoError(t, client.InitService(usClient))
+	resp, err := usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+	require.NoError(t, err)
+	assert.Equal(t, "plain", resp.Msg)
+}
@@ -0,0 +1,111 @@
+package transport
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"net"
+	"sync"
+)
+
+// DefaultBufferSize -> the default buffer size of each direction of the in-memory connections
+const DefaultBufferSize = 64 << 10
+
+var _ Transport = (*Memory)(nil)
+
+// Memory -> in-memory connections, like the bufconn of grpc
+// The server and the client share the same Memory, the address is just a name,
+// so the tests don't need any port and don't interfere with each other.
+type Memory struct {
+	bufferSize int
+	mutex      sync.Mutex
+	listeners  map[string]*memoryListener
+}
+
+// NewMemory -> bufferSize is the number of bytes a side can write before the other side reads them,
+// the writer blocks when the buffer is full. 0 means DefaultBufferSize.
+func NewMemory(bufferSize int) *Memory {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Memory{
+		bufferSize: bufferSize,
+		listeners:  make(map[string]*memoryListener, 4),
+	}
+}
+
+func (m *Memory) Dial(ctx context.Context, address string) (net.Conn, error) {
+	m.mutex.Lock()
+	l, ok := m.listeners[address]
+	m.mutex.Unlock()
+	if !ok {
+		return nil, errs.NoListener(address)
+	}
+	client, server := newPipe(m.bufferSize, memoryAddr("client"), memoryAddr(address))
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, errs.NoListener(address)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *Memory) Listen(address string) (net.Listener, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.listeners[address]; ok {
+		return nil, errs.AddressInUse(address)
+	}
+	l := &memoryListener{
+		memory: m,
+		addr:   memoryAddr(address),
+		conns:  make(chan net.Conn),
+		done:   make(chan struct{}),
+	}
+	m.listeners[address] = l
+	return l, nil
+}
+
+type memoryListener struct {
+	memory    *Memory
+	addr      memoryAddr
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close -> the address can be listened on again after it's closed,
+// the accepted connections are not affected
+func (l *memoryListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.memory.mutex.Lock()
+		delete(l.memory.listeners, string(l.addr))
+		l.memory.mutex.Unlock()
+	})
+	return nil
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return l.addr
+}
+
+type memoryAddr string
+
+func (_ memoryAddr) Network() string {
+	return "memory"
+}
+
+func (a memoryAddr) String() string {
+	return string(a)
+}
@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"context"
+	"emicro/internal/errs"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory(0)
+	_, err := m.Dial(context.Background(), "user-service")
+	assert.Equal(t, errs.NoListener("user-service"), err)
+
+	l, err := m.Listen("user-service")
+	require.NoError(t, err)
+	assert.Equal(t, "memory", l.Addr().Network())
+	_, err = m.Listen("user-service")
+	assert.Equal(t, errs.AddressInUse("user-service"), err)
+
+	go func() {
+		conn, er := l.Accept()
+		if er != nil {
+			return
+		}
+		bs := make([]byte, 5)
+		n, _ := conn.Read(bs)
+		_, _ = conn.Write(bs[:n])
+	}()
+	conn, err := m.Dial(context.Background(), "user-service")
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	bs := make([]byte, 5)
+	_, err = conn.Read(bs)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(bs))
+
+	// nobody accepts
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err = m.Dial(ctx, "user-service")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	require.NoError(t, l.Close())
+	_, err = l.Accept()
+	assert.ErrorIs(t, err, net.ErrClosed)
+	_, err = m.Dial(context.Background(), "user-service")
+	assert.Equal(t, errs.NoListener("user-service"), err)
+	// listen again
+	l, err = m.Listen("user-service")
+	require.NoError(t, err)
+	_ = l.Close()
+}
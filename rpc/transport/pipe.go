@@ -0,0 +1,243 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// newPipe -> a connected pair of in-memory connections
+// Unlike net.Pipe, each direction has a buffer of size bytes,
+// so a side can write without waiting for the other side to read, as a TCP connection does.
+func newPipe(size int, clientAddr, serverAddr net.Addr) (net.Conn, net.Conn) {
+	c2s, s2c := newPipeBuffer(size), newPipeBuffer(size)
+	client := newPipeConn(s2c, c2s, clientAddr, serverAddr)
+	server := newPipeConn(c2s, s2c, serverAddr, clientAddr)
+	return client, server
+}
+
+// pipeBuffer -> one direction of the pipe
+type pipeBuffer struct {
+	mutex  sync.Mutex
+	buf    bytes.Buffer
+	size   int
+	closed bool
+	// closed and replaced when the buffer changes, so the blocked reader and writer check it again
+	changed chan struct{}
+}
+
+func newPipeBuffer(size int) *pipeBuffer {
+	return &pipeBuffer{
+		size:    size,
+		changed: make(chan struct{}),
+	}
+}
+
+// notify -> must be called with the mutex held
+func (b *pipeBuffer) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// read -> the data written before the buffer is closed can still be read, then io.EOF
+func (b *pipeBuffer) read(p []byte, deadline *deadline, done <-chan struct{}) (int, error) {
+	for {
+		select {
+		case <-done:
+			return 0, net.ErrClosed
+		case <-deadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		default:
+		}
+		b.mutex.Lock()
+		if b.buf.Len() > 0 {
+			n, _ := b.buf.Read(p)
+			b.notify()
+			b.mutex.Unlock()
+			return n, nil
+		}
+		if b.closed {
+			b.mutex.Unlock()
+			return 0, io.EOF
+		}
+		changed := b.changed
+		b.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-deadline.wait():
+		case <-done:
+		}
+	}
+}
+
+// write -> block until all data is in the buffer, the buffer is closed or the deadline is exceeded
+func (b *pipeBuffer) write(p []byte, deadline *deadline, done <-chan struct{}) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		select {
+		case <-done:
+			return n, net.ErrClosed
+		case <-deadline.wait():
+			return n, os.ErrDeadlineExceeded
+		default:
+		}
+		b.mutex.Lock()
+		if b.closed {
+			b.mutex.Unlock()
+			return n, io.ErrClosedPipe
+		}
+		if space := b.size - b.buf.Len(); space > 0 {
+			k := min(space, len(p))
+			b.buf.Write(p[:k])
+			p = p[k:]
+			n += k
+			b.notify()
+			b.mutex.Unlock()
+			continue
+		}
+		changed := b.changed
+		b.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-deadline.wait():
+		case <-done:
+		}
+	}
+	return n, nil
+}
+
+func (b *pipeBuffer) close() {
+	b.mutex.Lock()
+	if !b.closed {
+		b.closed = true
+		b.notify()
+	}
+	b.mutex.Unlock()
+}
+
+type pipeConn struct {
+	// r is written by the other side, w is read by the other side
+	r, w          *pipeBuffer
+	local, remote net.Addr
+
+	readDeadline  *deadline
+	writeDeadline *deadline
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeConn(r, w *pipeBuffer, local, remote net.Addr) *pipeConn {
+	return &pipeConn{
+		r:             r,
+		w:             w,
+		local:         local,
+		remote:        remote,
+		readDeadline:  newDeadline(),
+		writeDeadline: newDeadline(),
+		done:          make(chan struct{}),
+	}
+}
+
+func (c *pipeConn) Read(p []byte) (int, error) {
+	return c.r.read(p, c.readDeadline, c.done)
+}
+
+func (c *pipeConn) Write(p []byte) (int, error) {
+	return c.w.write(p, c.writeDeadline, c.done)
+}
+
+// Close -> the other side reads the remaining data and then io.EOF, its writes fail
+func (c *pipeConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.r.close()
+		c.w.close()
+	})
+	return nil
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// deadline -> expired is closed when the deadline is exceeded
+type deadline struct {
+	mutex   sync.Mutex
+	timer   *time.Timer
+	expired chan struct{}
+}
+
+func newDeadline() *deadline {
+	return &deadline{expired: make(chan struct{})}
+}
+
+// set -> the zero time means no deadline
+func (d *deadline) set(t time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.timer != nil && !d.timer.Stop() {
+		// the timer is firing, wait until expired is closed
+		<-d.expired
+	}
+	d.timer = nil
+
+	expired := isClosed(d.expired)
+	if t.IsZero() {
+		if expired {
+			d.expired = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if expired {
+			d.expired = make(chan struct{})
+		}
+		ch := d.expired
+		d.timer = time.AfterFunc(dur, func() {
+			close(ch)
+		})
+		return
+	}
+	if !expired {
+		close(d.expired)
+	}
+}
+
+func (d *deadline) wait() <-chan struct{} {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.expired
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,59 @@
+package transport
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe(t *testing.T) {
+	client, server := newPipe(4, memoryAddr("client"), memoryAddr("server"))
+	assert.Equal(t, "server", client.RemoteAddr().String())
+	assert.Equal(t, "client", server.RemoteAddr().String())
+
+	// the data larger than the buffer is written after the other side reads
+	go func() {
+		_, _ = client.Write([]byte("hello world"))
+		_ = client.Close()
+	}()
+	data, err := io.ReadAll(server)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	// the other side is closed
+	_, err = server.Write([]byte("hello"))
+	assert.Equal(t, io.ErrClosedPipe, err)
+	_, err = client.Read(make([]byte, 4))
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestPipe_deadline(t *testing.T) {
+	client, server := newPipe(4, memoryAddr("client"), memoryAddr("server"))
+	defer func() {
+		_ = client.Close()
+		_ = server.Close()
+	}()
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(time.Millisecond*50)))
+	start := time.Now()
+	_, err := server.Read(make([]byte, 4))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*50)
+
+	// the buffer is full
+	require.NoError(t, client.SetWriteDeadline(time.Now().Add(time.Millisecond*50)))
+	n, err := client.Write([]byte("hello world"))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.Equal(t, 4, n)
+
+	// the deadline is cleared
+	require.NoError(t, server.SetReadDeadline(time.Time{}))
+	bs := make([]byte, 8)
+	n, err = server.Read(bs)
+	require.NoError(t, err)
+	assert.Equal(t, "hell", string(bs[:n]))
+}
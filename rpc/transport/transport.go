@@ -0,0 +1,29 @@
+package transport
+
+import (
+	"context"
+	"net"
+)
+
+// Transport -> how the client connects to the server and how the server accepts the connections
+// The frames are the same on every transport, TLS is applied on top of the connections.
+type Transport interface {
+	// Dial -> connect to the server listening on address
+	Dial(ctx context.Context, address string) (net.Conn, error)
+	// Listen -> listen on address, the server accepts the connections until the listener is closed
+	Listen(address string) (net.Listener, error)
+}
+
+var _ Transport = TCP{}
+
+// TCP -> the default transport, address is host:port
+type TCP struct{}
+
+func (_ TCP) Dial(ctx context.Context, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+func (_ TCP) Listen(address string) (net.Listener, error) {
+	return net.Listen("tcp", address)
+}
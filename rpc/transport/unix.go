@@ -0,0 +1,22 @@
+package transport
+
+import (
+	"context"
+	"net"
+)
+
+var _ Transport = Unix{}
+
+// Unix -> Unix domain sockets, address is the path of the socket file
+// It's usually used between the application and its sidecar on the same host.
+// The socket file is removed when the listener is closed.
+type Unix struct{}
+
+func (_ Unix) Dial(ctx context.Context, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "unix", address)
+}
+
+func (_ Unix) Listen(address string) (net.Listener, error) {
+	return net.Listen("unix", address)
+}
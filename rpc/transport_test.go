@@ -0,0 +1,102 @@
+package rpc
+
+import (
+	"context"
+	"emicro/rpc/transport"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport(t *testing.T) {
+	testCases := []struct {
+		name      string
+		transport transport.Transport
+		address   string
+	}{
+		{
+			name:      "memory",
+			transport: transport.NewMemory(0),
+			address:   "user-service",
+		},
+		{
+			name: "memory small buffer",
+			// the frames are larger than the buffer
+			transport: transport.NewMemory(8),
+			address:   "user-service",
+		},
+		{
+			name:      "unix",
+			transport: transport.Unix{},
+			address:   filepath.Join(t.TempDir(), "emicro.sock"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer(ServerWithTransport(tc.transport))
+			_ = server.RegisterService(&echoService{})
+			listener, err := tc.transport.Listen(tc.address)
+			require.NoError(t, err)
+			go func() {
+				_ = server.Serve(listener)
+			}()
+			defer func() {
+				_ = server.Close()
+			}()
+
+			client, err := NewClient(tc.address, ClientWithTransport(tc.transport))
+			require.NoError(t, err)
+			defer func() {
+				_ = client.Close()
+			}()
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(id int) {
+					defer wg.Done()
+					out := &GetByIdResp{}
+					er := client.Call(context.Background(), "user-service", "GetById", &GetByIdReq{Id: id}, out)
+					assert.NoError(t, er)
+					assert.Equal(t, strconv.Itoa(id), out.Msg)
+				}(i)
+			}
+			wg.Wait()
+
+		})
+	}
+}
+
+func TestClient_DialContext(t *testing.T) {
+	mem := transport.NewMemory(0)
+	// the server accepts the connections but never replies to the handshake
+	listener, err := mem.Listen("silent-service")
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		for {
+			if _, er := listener.Accept(); er != nil {
+				return
+			}
+		}
+	}()
+
+	client, err := NewClient("silent-service", ClientWithTransport(mem))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	start := time.Now()
+	err = client.Call(ctx, "user-service", "GetById", &GetByIdReq{Id: 1}, &GetByIdResp{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	// the handshake timeout is much longer
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -9,6 +9,17 @@ type Proxy interface {
 	Invoke(ctx context.Context, request *message2.Request) (*message2.Response, error)
 }
 
+// StreamProxy -> proxy which supports streaming calls
+type StreamProxy interface {
+	NewStream(ctx context.Context, request *message2.Request) (ClientStream, error)
+}
+
+// Caller -> what the generated client stubs need, Client implements it
+type Caller interface {
+	Call(ctx context.Context, serviceName, methodName string, in, out any) error
+	Stream(ctx context.Context, serviceName, methodName string) (ClientStream, error)
+}
+
 type Service interface {
 	Name() string
 }